@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Блокировка пользователей: users.status = 'blocked', необязательные block_reason
+// и block_until (UTC, "2006-01-02 15:04:05"). Блокировка с истёкшим block_until снимается
+// при первой же проверке. Проверяется при входе (loginHandler) и на каждом запросе
+// с сессией к маршрутам API (authMiddleware, см. auth.go).
+
+const blockTimeLayout = "2006-01-02 15:04:05"
+
+// accountBlock — действующая блокировка пользователя
+type accountBlock struct {
+	Reason string
+	Until  time.Time // нулевое — бессрочно
+}
+
+// userBlock возвращает блокировку пользователя или nil, если он активен
+func userBlock(db *sql.DB, username string) (*accountBlock, error) {
+	var status string
+	var reason, until sql.NullString
+	err := db.QueryRow("SELECT COALESCE(status, 'active'), block_reason, block_until FROM users WHERE username = ?", username).
+		Scan(&status, &reason, &until)
+	if err != nil {
+		return nil, err
+	}
+	if status != "blocked" {
+		return nil, nil
+	}
+	b := &accountBlock{Reason: reason.String}
+	if until.Valid && until.String != "" {
+		t, err := parseBlockTime(until.String)
+		switch {
+		case err != nil:
+			log.Printf("Accounts: неверный block_until у %s: %q", username, until.String)
+		case t.After(time.Now()):
+			b.Until = t
+		default:
+			// Срок блокировки вышел
+			_, err := db.Exec("UPDATE users SET status = 'active', block_reason = NULL, block_until = NULL WHERE username = ? AND status = 'blocked'", username)
+			if err != nil {
+				return nil, err
+			}
+			log.Printf("Accounts: блокировка %s истекла", username)
+			return nil, nil
+		}
+	}
+	return b, nil
+}
+
+// parseBlockTime разбирает block_until: так его пишет сервер, или RFC 3339 (от драйвера и из запроса)
+func parseBlockTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(blockTimeLayout, s)
+}
+
+// writeBlockedError — ответ заблокированному пользователю (403, code = account_blocked)
+func writeBlockedError(w http.ResponseWriter, b *accountBlock) {
+	msg := "Учётная запись заблокирована"
+	resp := map[string]interface{}{"code": "account_blocked"}
+	if !b.Until.IsZero() {
+		msg += " до " + b.Until.Local().Format("02.01.2006 15:04")
+		resp["block_until"] = b.Until.UTC().Format(time.RFC3339)
+	}
+	if b.Reason != "" {
+		msg += ": " + b.Reason
+		resp["block_reason"] = b.Reason
+	}
+	resp["error"] = msg
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// blockRequest — тело запроса на блокировку: until — RFC 3339 или "2006-01-02 15:04:05" (UTC)
+type blockRequest struct {
+	Username string `json:"username"`
+	Reason   string `json:"reason"`
+	Until    string `json:"until"`
+}
+
+// reason — причина для записи в БД (nil — не указана)
+func (req blockRequest) reason() interface{} {
+	if r := strings.TrimSpace(req.Reason); r != "" {
+		return r
+	}
+	return nil
+}
+
+// blockUntil проверяет until из запроса и возвращает его для записи в БД (nil — бессрочно)
+func (req blockRequest) blockUntil() (interface{}, error) {
+	if req.Until == "" {
+		return nil, nil
+	}
+	t, err := parseBlockTime(req.Until)
+	if err != nil {
+		return nil, fmt.Errorf("Неверная дата окончания блокировки %q", req.Until)
+	}
+	if !t.After(time.Now()) {
+		return nil, fmt.Errorf("Дата окончания блокировки уже прошла")
+	}
+	return t.UTC().Format(blockTimeLayout), nil
+}
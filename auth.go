@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+)
+
+// Аутентификация и права доступа. Кому открыт маршрут, указано в таблице appRoutes.
+// На маршрутах из неё (и только на них — статика идёт мимо) authMiddleware один раз
+// на запрос находит пользователя по cookie user_session и кладёт его в контекст запроса,
+// а requireAccess не пускает к обработчику остальных. Обработчик за маршрутом
+// accessUser/accessAdmin может рассчитывать, что currentUser(r) не nil.
+
+// authUser — вошедший пользователь
+type authUser struct {
+	ID       int64
+	Username string
+	Role     string
+	Session  string // токен сессии из cookie
+}
+
+func (u *authUser) IsAdmin() bool {
+	return u != nil && u.Role == "admin"
+}
+
+type authContextKey struct{}
+
+// currentUser — пользователь запроса или nil, если запрос без входа
+func currentUser(r *http.Request) *authUser {
+	u, _ := r.Context().Value(authContextKey{}).(*authUser)
+	return u
+}
+
+// routeAccess — кому открыт маршрут
+type routeAccess int
+
+const (
+	accessPublic routeAccess = iota // всем, в том числе без входа
+	accessUser                      // любому вошедшему пользователю
+	accessAdmin                     // только админу
+)
+
+// route — маршрут сервера. page — HTML-страница: вместо JSON-ошибки отправляем на главную.
+type route struct {
+	pattern string
+	access  routeAccess
+	handler http.HandlerFunc
+	page    bool
+}
+
+// appRoutes — все маршруты API и защищённых страниц
+func appRoutes() []route {
+	return []route{
+		{pattern: "/api/login", access: accessPublic, handler: loginHandler},
+		{pattern: "/api/logout", access: accessPublic, handler: logoutHandler},
+		{pattern: "/api/whoami", access: accessUser, handler: whoamiHandler},
+		{pattern: "/api/sessions", access: accessUser, handler: sessionsHandler},
+		{pattern: "/api/sessions/revoke", access: accessUser, handler: revokeSessionHandler},
+
+		{pattern: "/api/templates", access: accessPublic, handler: getTemplatesHandler},
+		// Вебхук Nexrender защищён своим токеном, см. webhook.go
+		{pattern: "/api/nexrender/webhook", access: accessPublic, handler: nexrenderWebhookHandler},
+
+		{pattern: "/save-task", access: accessUser, handler: saveTaskHandler},
+		{pattern: "/save-sequence", access: accessUser, handler: saveSequenceHandler},
+		{pattern: "/api/import", access: accessUser, handler: importDataHandler},
+		{pattern: "/api/birzha/latest", access: accessUser, handler: marketDataHandler},
+		{pattern: "/api/demilit/totals", access: accessUser, handler: demilitTotalsHandler},
+		{pattern: "/api/render-status", access: accessUser, handler: renderStatusHandler},
+		{pattern: "/api/render-history", access: accessUser, handler: renderHistoryHandler},
+		{pattern: "/api/render-events", access: accessUser, handler: renderEventsHandler},
+		{pattern: "/api/renders/cancel", access: accessUser, handler: cancelRenderHandler},
+
+		// --- Защита админки через сервер ---
+		{pattern: "/protected/admin.html", access: accessAdmin, handler: adminPageHandler, page: true},
+
+		{pattern: "/api/admin/stats", access: accessAdmin, handler: adminStatsHandler},
+		{pattern: "/api/admin/renders", access: accessAdmin, handler: adminRendersHandler},
+		{pattern: "/api/admin/renders/delete", access: accessAdmin, handler: adminDeleteRenderHandler},
+		{pattern: "/api/admin/renders/restart", access: accessAdmin, handler: adminRestartRenderHandler},
+		{pattern: "/api/admin/renders/priority", access: accessAdmin, handler: adminRenderPriorityHandler},
+		{pattern: "/api/admin/nexrender", access: accessAdmin, handler: adminNexrenderHandler},
+		{pattern: "/api/admin/templates/schema", access: accessAdmin, handler: adminTemplateSchemaHandler},
+		{pattern: "/api/admin/users/create", access: accessAdmin, handler: adminCreateUserHandler},
+		{pattern: "/api/admin/users", access: accessAdmin, handler: adminUsersListHandler},
+		{pattern: "/api/admin/users/delete", access: accessAdmin, handler: adminDeleteUserHandler},
+		{pattern: "/api/admin/users/block", access: accessAdmin, handler: adminBlockUserHandler},
+		{pattern: "/api/admin/users/unblock", access: accessAdmin, handler: adminUnblockUserHandler},
+		{pattern: "/api/admin/sessions", access: accessAdmin, handler: adminSessionsHandler},
+		{pattern: "/api/admin/sessions/revoke", access: accessAdmin, handler: adminRevokeSessionsHandler},
+		// Остальные /api/admin/* — 404, но тоже только админу
+		{pattern: "/api/admin/", access: accessAdmin, handler: http.NotFound},
+	}
+}
+
+// registerRoutes вешает маршруты appRoutes на mux, каждый — за проверкой доступа
+func registerRoutes(mux *http.ServeMux) {
+	for _, rt := range appRoutes() {
+		mux.Handle(rt.pattern, authMiddleware(rt, requireAccess(rt)))
+	}
+}
+
+// requireAccess пропускает к обработчику маршрута только тех, кому он открыт
+func requireAccess(rt route) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := currentUser(r)
+		status := 0
+		switch {
+		case rt.access == accessPublic:
+		case user == nil:
+			status = http.StatusUnauthorized
+		case rt.access == accessAdmin && !user.IsAdmin():
+			status = http.StatusForbidden
+		}
+		if status == 0 {
+			rt.handler(w, r)
+			return
+		}
+		if rt.page {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		if status == http.StatusUnauthorized {
+			writeJsonError(w, "Unauthorized", status)
+		} else {
+			writeJsonError(w, "Forbidden", status)
+		}
+	})
+}
+
+// authMiddleware находит пользователя по сессии и кладёт его в контекст запроса к маршруту rt.
+// Запрос без сессии или с недействительной сессией идёт дальше без пользователя.
+// Сессия заблокированного пользователя завершается, в ответ — ошибка account_blocked
+// (см. accounts.go), а со страницы — на главную.
+func authMiddleware(rt route, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("user_session")
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		username, ok := sessionUser(cookie.Value)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		db, err := sql.Open("sqlite3", cfg.DBPath)
+		if err != nil {
+			writeJsonError(w, "DB error", http.StatusInternalServerError)
+			return
+		}
+		user := &authUser{Username: username, Session: cookie.Value}
+		err = db.QueryRow("SELECT id, role FROM users WHERE username = ?", username).Scan(&user.ID, &user.Role)
+		var block *accountBlock
+		if err == nil {
+			block, err = userBlock(db, username)
+		}
+		db.Close()
+		switch {
+		case err == sql.ErrNoRows:
+			// Пользователя удалили — сессия больше ничья
+			deleteSession(cookie.Value)
+			next.ServeHTTP(w, r)
+			return
+		case err != nil:
+			log.Println("Auth: DB error:", err)
+			writeJsonError(w, "DB error", http.StatusInternalServerError)
+			return
+		case block != nil:
+			deleteSession(cookie.Value)
+			if rt.page {
+				http.Redirect(w, r, "/", http.StatusFound)
+				return
+			}
+			writeBlockedError(w, block)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authContextKey{}, user)))
+	})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newAuthTestServer поднимает сервер с маршрутами appRoutes на копии templates.db
+// и возвращает его вместе с токенами сессий админа и обычного пользователя.
+func newAuthTestServer(t *testing.T) (srv *httptest.Server, adminToken, userToken string) {
+	t.Helper()
+
+	data, err := os.ReadFile("templates.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbPath := filepath.Join(t.TempDir(), "templates.db")
+	if err := os.WriteFile(dbPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldCfg, oldRenderer := cfg, renderer
+	testCfg := *cfg
+	testCfg.DBPath = dbPath
+	testCfg.OutputDir = t.TempDir()
+	cfg = &testCfg
+	renderer = newFakeBackend(time.Second)
+	t.Cleanup(func() { cfg, renderer = oldCfg, oldRenderer })
+
+	if err := migrateDB(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, u := range []struct{ name, role string }{{"test-admin", "admin"}, {"test-user", "user"}} {
+		_, err := db.Exec("INSERT INTO users (username, password, role, status) VALUES (?, '-', ?, 'active')", u.name, u.role)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	if adminToken, err = createSession("test-admin", r); err != nil {
+		t.Fatal(err)
+	}
+	if userToken, err = createSession("test-user", r); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	registerRoutes(mux)
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, adminToken, userToken
+}
+
+// adminRoutes — все маршруты /api/admin/*
+func adminRoutes(t *testing.T) []route {
+	t.Helper()
+	var routes []route
+	for _, rt := range appRoutes() {
+		if strings.HasPrefix(rt.pattern, "/api/admin/") {
+			routes = append(routes, rt)
+		}
+	}
+	if len(routes) == 0 {
+		t.Fatal("в appRoutes нет маршрутов /api/admin/")
+	}
+	return routes
+}
+
+func doAuthRequest(t *testing.T, srv *httptest.Server, method, path, token string) int {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.AddCookie(&http.Cookie{Name: "user_session", Value: token})
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestAdminRoutesRejectNonAdmins(t *testing.T) {
+	srv, _, userToken := newAuthTestServer(t)
+	paths := []string{"/api/admin/unknown"}
+	for _, rt := range adminRoutes(t) {
+		paths = append(paths, rt.pattern)
+	}
+	for _, path := range paths {
+		for _, method := range []string{http.MethodGet, http.MethodPost} {
+			if code := doAuthRequest(t, srv, method, path, ""); code != http.StatusUnauthorized {
+				t.Errorf("%s %s без входа: %d, ожидался 401", method, path, code)
+			}
+			if code := doAuthRequest(t, srv, method, path, "bad-token"); code != http.StatusUnauthorized {
+				t.Errorf("%s %s с чужим токеном: %d, ожидался 401", method, path, code)
+			}
+			if code := doAuthRequest(t, srv, method, path, userToken); code != http.StatusForbidden {
+				t.Errorf("%s %s от пользователя: %d, ожидался 403", method, path, code)
+			}
+		}
+	}
+}
+
+func TestAdminRoutesAllowAdmin(t *testing.T) {
+	srv, adminToken, _ := newAuthTestServer(t)
+	for _, rt := range adminRoutes(t) {
+		for _, method := range []string{http.MethodGet, http.MethodPost} {
+			code := doAuthRequest(t, srv, method, rt.pattern, adminToken)
+			if code == http.StatusUnauthorized || code == http.StatusForbidden {
+				t.Errorf("%s %s от админа: %d", method, rt.pattern, code)
+			}
+		}
+	}
+}
+
+func TestAdminPageRedirectsNonAdmins(t *testing.T) {
+	srv, _, userToken := newAuthTestServer(t)
+	for _, token := range []string{"", userToken} {
+		if code := doAuthRequest(t, srv, http.MethodGet, "/protected/admin.html", token); code != http.StatusFound {
+			t.Errorf("admin.html (токен %q): %d, ожидался 302", token, code)
+		}
+	}
+}
+
+func TestBlockedUserRejected(t *testing.T) {
+	srv, adminToken, userToken := newAuthTestServer(t)
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("UPDATE users SET status = 'blocked' WHERE username IN ('test-user', 'test-admin')"); err != nil {
+		t.Fatal(err)
+	}
+	if code := doAuthRequest(t, srv, http.MethodGet, "/api/whoami", userToken); code != http.StatusForbidden {
+		t.Errorf("whoami заблокированного: %d, ожидался 403", code)
+	}
+	// Со страницы заблокированного отправляем на главную, а не отдаём JSON
+	if code := doAuthRequest(t, srv, http.MethodGet, "/protected/admin.html", adminToken); code != http.StatusFound {
+		t.Errorf("admin.html заблокированного: %d, ожидался 302", code)
+	}
+	// Сессии заблокированных завершены
+	for _, token := range []string{userToken, adminToken} {
+		if _, ok := sessionUser(token); ok {
+			t.Error("сессия заблокированного пользователя не завершена")
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// Текстовые карточки: большой текст (шаблоны 12.x) и Графсправка (17.1)
+
+// textBox — размер текстового блока шаблона в символах и строках
+type textBox struct {
+	Label     string `json:"label"` // для сообщений редактору
+	LineChars int    `json:"lineChars"`
+	MaxLines  int    `json:"maxLines"`
+	Required  bool   `json:"required"`
+}
+
+// Настройки текстовых карточек (options в схеме шаблона)
+type bigTextOptions struct {
+	Texts       map[string]textBox `json:"texts"` // ключ — имя поля в params: headline, body, ...
+	AccentColor string             `json:"accentColor"`
+}
+
+// styleRange — выделенный участок текста. Start и Length считаются в UTF-16,
+// как индексы строк в выражениях After Effects.
+type styleRange struct {
+	Start  int
+	Length int
+	Bold   bool
+	Accent bool
+}
+
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// parseMarkup разбирает разметку редактора: **жирный**, ==акцент==, перенос строки.
+// Возвращает текст без разметки и выделенные участки.
+func parseMarkup(s string) (string, []styleRange, error) {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	var plain strings.Builder
+	var ranges []styleRange
+	bold, accent := false, false
+	runStart, pos := 0, 0
+	// closeRun фиксирует участок с текущим стилем перед сменой стиля
+	closeRun := func() {
+		if (bold || accent) && pos > runStart {
+			ranges = append(ranges, styleRange{Start: runStart, Length: pos - runStart, Bold: bold, Accent: accent})
+		}
+		runStart = pos
+	}
+	for len(s) > 0 {
+		switch {
+		case strings.HasPrefix(s, "**"):
+			closeRun()
+			bold = !bold
+			s = s[2:]
+		case strings.HasPrefix(s, "=="):
+			closeRun()
+			accent = !accent
+			s = s[2:]
+		default:
+			r := []rune(s)[0]
+			if r == '\n' {
+				r = '\r'
+			}
+			plain.WriteRune(r)
+			pos += utf16Len(string(r))
+			s = s[len(string([]rune(s)[0])):]
+		}
+	}
+	if bold {
+		return "", nil, fmt.Errorf("не закрыто выделение жирным (**)")
+	}
+	if accent {
+		return "", nil, fmt.Errorf("не закрыто выделение цветом (==)")
+	}
+	return plain.String(), ranges, nil
+}
+
+// styleExpression собирает выражение для Source Text: текст и стили участков.
+// Посимвольные стили в выражениях есть начиная с After Effects 24.3.
+func styleExpression(plain string, ranges []styleRange, accent []float64) string {
+	quoted, _ := json.Marshal(plain)
+	var b strings.Builder
+	fmt.Fprintf(&b, "text.sourceText.style.setText(%s)", quoted)
+	for _, r := range ranges {
+		if r.Bold {
+			fmt.Fprintf(&b, ".setFauxBold(true, %d, %d)", r.Start, r.Length)
+		}
+		if r.Accent && accent != nil {
+			fmt.Fprintf(&b, ".setFillColor([%g, %g, %g], %d, %d)", accent[0], accent[1], accent[2], r.Start, r.Length)
+		}
+	}
+	return b.String()
+}
+
+// countLines оценивает, сколько строк займёт текст в блоке шириной width символов
+func countLines(plain string, width int) int {
+	n := 0
+	for _, par := range strings.Split(plain, "\r") {
+		if lines := len(wrapText(par, width)); lines > 0 {
+			n += lines
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// buildBigTextParams разбирает разметку в текстовых полях карточки и проверяет, что текст влезает в блок.
+//
+// params: {"headline": "...", "body": "Текст с **жирным** и ==акцентом=="}, логотип — файл logo.
+// Для каждого поля из options.texts добавляются <имя>Plain (текст без разметки)
+// и <имя>Style (выражение AE со стилями). Исходный текст не меняется, чтобы перезапуск давал то же самое.
+func buildBigTextParams(schema *TemplateSchema, params map[string]interface{}) error {
+	opts := bigTextOptions{AccentColor: "#E30613"}
+	if err := schema.decodeOptions(&opts); err != nil {
+		return err
+	}
+	if len(opts.Texts) == 0 {
+		return fmt.Errorf("Ошибка в настройках шаблона: не заданы texts")
+	}
+	accent, err := hexToColor(opts.AccentColor)
+	if err != nil {
+		return fmt.Errorf("Ошибка в настройках шаблона: %v", err)
+	}
+
+	names := make([]string, 0, len(opts.Texts))
+	for name := range opts.Texts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		box := opts.Texts[name]
+		label := box.Label
+		if label == "" {
+			label = name
+		}
+		text := strings.TrimSpace(toString(params[name]))
+		if text == "" {
+			if box.Required {
+				return invalidf("%s: пустой текст", label)
+			}
+			params[name+"Plain"] = ""
+			params[name+"Style"] = styleExpression("", nil, nil)
+			continue
+		}
+		plain, ranges, err := parseMarkup(text)
+		if err != nil {
+			return invalidf("%s: %v", label, err)
+		}
+		if box.LineChars > 0 && box.MaxLines > 0 {
+			if lines := countLines(plain, box.LineChars); lines > box.MaxLines {
+				addWarning(params, "%s: текст не помещается в блок (примерно %d строк из %d)", label, lines, box.MaxLines)
+			}
+		}
+		params[name+"Plain"] = plain
+		params[name+"Style"] = styleExpression(plain, ranges, accent)
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Биржевые сводки (шаблоны 20.x)
+
+// Файлы с котировками кладут в cfg.MarketWatchDir: asia.json, europe.csv, america.json ...
+// Имя файла без расширения — регион из options шаблона.
+// Сколько строк в шаблоне, задаёт группа indices.
+
+type birzhaOptions struct {
+	Region    string `json:"region"` // asia, europe, america
+	Decimals  int    `json:"decimals"`
+	UpColor   string `json:"upColor"`
+	DownColor string `json:"downColor"`
+	FlatColor string `json:"flatColor"`
+}
+
+// formatSignedRu — число со знаком: "+1 234,5" / "-0,8" (минус тот же, что у formatNumberRu)
+func formatSignedRu(v float64, decimals int) string {
+	s := formatNumberRu(v, decimals)
+	if v > 0 && strings.Trim(s, "0, ") != "" {
+		return "+" + s
+	}
+	return s
+}
+
+// buildBirzhaParams считает направление, цвет и подписи для каждого индекса.
+//
+// params: {"indices": [{"name": "Nikkei 225", "value": 38450.1, "change": -120.3, "changePercent": -0.31}, ...]}
+// или {"fromFile": true} — взять последние котировки региона из cfg.MarketWatchDir.
+func buildBirzhaParams(schema *TemplateSchema, params map[string]interface{}) error {
+	opts := birzhaOptions{Decimals: 2, UpColor: "#2BB24C", DownColor: "#E30613", FlatColor: "#9D9D9C"}
+	if err := schema.decodeOptions(&opts); err != nil {
+		return err
+	}
+	g, err := schema.group("indices")
+	if err != nil {
+		return err
+	}
+
+	if fromFile, _ := params["fromFile"].(bool); fromFile {
+		indices, loadedAt, err := loadMarketData(opts.Region)
+		if err != nil {
+			return err
+		}
+		params["indices"] = indices
+		params["loadedAt"] = loadedAt
+		// При перезапуске рендера используем те же цифры, а не свежий файл
+		delete(params, "fromFile")
+	}
+
+	indices := groupItems(params, "indices")
+	if len(indices) == 0 {
+		return invalidf("Не переданы биржевые индексы")
+	}
+	if len(indices) > g.Max {
+		return invalidf("В шаблоне максимум %d индексов, передано %d", g.Max, len(indices))
+	}
+
+	for i, idx := range indices {
+		if toString(idx["name"]) == "" {
+			return invalidf("Индекс %d: не указано название", i+1)
+		}
+		value, ok := toFloat(idx["value"])
+		if !ok {
+			return invalidf("Индекс %d: значение должно быть числом", i+1)
+		}
+		change, ok := toFloat(idx["change"])
+		if !ok {
+			return invalidf("Индекс %d: изменение должно быть числом", i+1)
+		}
+		percent, ok := toFloat(idx["changePercent"])
+		if !ok {
+			// Процент можно не передавать — посчитаем от значения на открытии
+			if prev := value - change; prev != 0 {
+				percent = change / prev * 100
+			}
+		}
+
+		// Направление определяем по абсолютному изменению, процент мог прийти округлённым
+		direction, color := 0, opts.FlatColor
+		switch {
+		case change > 0:
+			direction, color = 1, opts.UpColor
+		case change < 0:
+			direction, color = -1, opts.DownColor
+		}
+		rgb, err := hexToColor(color)
+		if err != nil {
+			return fmt.Errorf("Ошибка в настройках шаблона: %v", err)
+		}
+		idx["direction"] = direction
+		idx["upOpacity"], idx["downOpacity"] = 0, 0
+		if direction > 0 {
+			idx["upOpacity"] = 100
+		} else if direction < 0 {
+			idx["downOpacity"] = 100
+		}
+		idx["rgb"] = rgb
+		idx["valueText"] = formatNumberRu(value, opts.Decimals)
+		idx["changeText"] = formatSignedRu(change, opts.Decimals)
+		idx["percentText"] = formatSignedRu(percent, 2) + "%"
+	}
+	return nil
+}
+
+// --- Котировки из файлов в cfg.MarketWatchDir ---
+
+// parseMarketFile читает JSON (массив или {"indices": [...]}) или CSV: name;value;change;changePercent
+func parseMarketFile(path string) ([]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		var list []interface{}
+		if err := json.Unmarshal(data, &list); err == nil {
+			return list, nil
+		}
+		var wrapped struct {
+			Indices []interface{} `json:"indices"`
+		}
+		if err := json.Unmarshal(data, &wrapped); err != nil {
+			return nil, err
+		}
+		return wrapped.Indices, nil
+	case ".csv":
+		table, err := parseCSV(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(table.Headers) < 3 {
+			return nil, fmt.Errorf("ожидаются колонки: название, значение, изменение, изменение в %%")
+		}
+		var list []interface{}
+		for _, row := range table.Rows {
+			idx := map[string]interface{}{"name": row[0], "value": row[1], "change": row[2]}
+			if len(row) > 3 && row[3] != "" {
+				idx["changePercent"] = row[3]
+			}
+			list = append(list, idx)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("неподдерживаемый формат %s", filepath.Ext(path))
+}
+
+func saveMarketData(region string, indices []interface{}) error {
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	raw, _ := json.Marshal(indices)
+	_, err = db.Exec(`INSERT INTO market_data (region, data, loaded_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(region) DO UPDATE SET data = excluded.data, loaded_at = excluded.loaded_at`, region, string(raw))
+	return err
+}
+
+func loadMarketData(region string) ([]interface{}, string, error) {
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		return nil, "", err
+	}
+	defer db.Close()
+	var raw, loadedAt string
+	err = db.QueryRow("SELECT data, loaded_at FROM market_data WHERE region = ?", region).Scan(&raw, &loadedAt)
+	if err != nil {
+		return nil, "", invalidf("Нет загруженных котировок для региона %q", region)
+	}
+	var indices []interface{}
+	if err := json.Unmarshal([]byte(raw), &indices); err != nil {
+		return nil, "", err
+	}
+	return indices, loadedAt, nil
+}
+
+// startMarketWatcher раз в 10 секунд проверяет папку с котировками
+// и загружает в БД новые или изменённые файлы
+func startMarketWatcher() {
+	go func() {
+		seen := make(map[string]time.Time)
+		failed := make(map[string]time.Time) // чтобы не писать в лог одну и ту же ошибку каждые 10 секунд
+		for {
+			entries, err := os.ReadDir(cfg.MarketWatchDir)
+			if err == nil {
+				for _, e := range entries {
+					ext := strings.ToLower(filepath.Ext(e.Name()))
+					if e.IsDir() || (ext != ".json" && ext != ".csv") {
+						continue
+					}
+					info, err := e.Info()
+					if err != nil || !info.ModTime().After(seen[e.Name()]) {
+						continue
+					}
+					path := filepath.Join(cfg.MarketWatchDir, e.Name())
+					region := strings.ToLower(strings.TrimSuffix(e.Name(), filepath.Ext(e.Name())))
+					// Файл отмечаем прочитанным только после загрузки: недописанный
+					// или не сохранённый файл попробуем снова на следующем проходе
+					indices, err := parseMarketFile(path)
+					if err != nil {
+						if !failed[e.Name()].Equal(info.ModTime()) {
+							failed[e.Name()] = info.ModTime()
+							log.Printf("MarketWatcher: ошибка чтения %s: %v", path, err)
+						}
+						continue
+					}
+					delete(failed, e.Name())
+					if err := saveMarketData(region, indices); err != nil {
+						log.Printf("MarketWatcher: ошибка записи %s: %v", region, err)
+						continue
+					}
+					seen[e.Name()] = info.ModTime()
+					log.Printf("MarketWatcher: загружены котировки %s (%d индексов)", region, len(indices))
+				}
+			}
+			time.Sleep(10 * time.Second)
+		}
+	}()
+}
+
+// Последние котировки региона из папки — для предпросмотра в форме
+func marketDataHandler(w http.ResponseWriter, r *http.Request) {
+	indices, loadedAt, err := loadMarketData(r.URL.Query().Get("region"))
+	if err != nil {
+		writeJsonError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"indices":   indices,
+		"loaded_at": loadedAt,
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Настройки столбчатых диаграмм (options в схеме шаблона)
+type barOptions struct {
+	Series    int     `json:"series"`    // число значений в строке: 1–3
+	MaxHeight float64 `json:"maxHeight"` // длина самого большого столбца в пикселях композиции
+	Decimals  int     `json:"decimals"`  // -1 — сколько нужно, до двух знаков
+	Unit      string  `json:"unit"`      // дописывается к подписи значения: "%", " млн" и т.п.
+}
+
+const maxBarSeries = 3
+
+// buildBarParams проверяет таблицу chart_bar и дописывает в каждую строку высоты столбцов.
+//
+// params: {"series": ["2023", "2024"], "rows": [{"label": "...", "values": [10, 12]}, ...]}
+// В строку добавляются height1..3 (в пикселях) и valueText1..3, в params — seriesName1..3 и totalText.
+func buildBarParams(schema *TemplateSchema, params map[string]interface{}) error {
+	opts := barOptions{Series: 1, MaxHeight: 100, Decimals: -1}
+	if err := schema.decodeOptions(&opts); err != nil {
+		return err
+	}
+	if opts.Series < 1 || opts.Series > maxBarSeries {
+		return fmt.Errorf("Ошибка в настройках шаблона: series должно быть от 1 до %d", maxBarSeries)
+	}
+
+	rows := groupItems(params, "rows")
+	if len(rows) == 0 {
+		return invalidf("Не переданы строки диаграммы")
+	}
+
+	values := make([][]float64, len(rows))
+	maxValue, total := 0.0, 0.0
+	for i, row := range rows {
+		raw, ok := row["values"].([]interface{})
+		if !ok {
+			// Для одной серии допускаем просто "value"
+			raw = []interface{}{row["value"]}
+		}
+		if len(raw) != opts.Series {
+			return invalidf("Строка %d: ожидается значений — %d, передано %d", i+1, opts.Series, len(raw))
+		}
+		for j, rv := range raw {
+			v, ok := toFloat(rv)
+			if !ok {
+				return invalidf("Строка %d, значение %d: ожидается число", i+1, j+1)
+			}
+			if v < 0 {
+				return invalidf("Строка %d, значение %d: отрицательные значения не поддерживаются", i+1, j+1)
+			}
+			values[i] = append(values[i], v)
+			total += v
+			if v > maxValue {
+				maxValue = v
+			}
+		}
+	}
+
+	for i, row := range rows {
+		for j, v := range values[i] {
+			height := 0.0
+			if maxValue > 0 {
+				height = v / maxValue * opts.MaxHeight
+			}
+			n := strconv.Itoa(j + 1)
+			row["height"+n] = height
+			row["valueText"+n] = formatNumberRu(v, opts.Decimals) + opts.Unit
+		}
+	}
+
+	names, _ := params["series"].([]interface{})
+	for j := 0; j < opts.Series && j < len(names); j++ {
+		params["seriesName"+strconv.Itoa(j+1)] = toString(names[j])
+	}
+	params["totalText"] = formatNumberRu(total, opts.Decimals) + opts.Unit
+	return nil
+}
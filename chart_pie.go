@@ -0,0 +1,83 @@
+package main
+
+import "math"
+
+// Настройки круговых/пончиковых диаграмм (options в схеме шаблона)
+type pieOptions struct {
+	Independent bool     `json:"independent"` // каждая диаграмма — своё целое (2.3, 2.4, 2.6)
+	Tolerance   float64  `json:"tolerance"`   // допустимое отклонение суммы от 100%
+	Decimals    int      `json:"decimals"`    // знаков после запятой в подписи процента, -1 — сколько нужно
+	Colors      []string `json:"colors"`      // палитра по умолчанию, "#RRGGBB"
+}
+
+// buildPieParams проверяет сегменты chart_pie/chart_donut и дописывает в каждый
+// percent, percentText, start и rgb для схемы шаблона.
+//
+// params: {"segments": [{"label": "...", "value": 45, "color": "#ff0000"}, ...]}
+// Сколько значений принимает вариант шаблона, задаёт группа segments в схеме.
+func buildPieParams(schema *TemplateSchema, params map[string]interface{}) error {
+	opts := pieOptions{Tolerance: 1, Decimals: -1}
+	if err := schema.decodeOptions(&opts); err != nil {
+		return err
+	}
+
+	g, err := schema.group("segments")
+	if err != nil {
+		return err
+	}
+	segments := groupItems(params, "segments")
+	if len(segments) == 0 {
+		return invalidf("Не переданы значения диаграммы")
+	}
+	if g.Min == g.Max && len(segments) != g.Max {
+		return invalidf("Шаблон рассчитан на %d значений, передано %d", g.Max, len(segments))
+	}
+	if len(segments) < g.Min || len(segments) > g.Max {
+		return invalidf("Шаблон рассчитан на %d–%d значений, передано %d", g.Min, g.Max, len(segments))
+	}
+
+	sum := 0.0
+	values := make([]float64, len(segments))
+	for i, seg := range segments {
+		v, ok := toFloat(seg["value"])
+		if !ok {
+			return invalidf("Значение %d: ожидается число", i+1)
+		}
+		if v < 0 || v > 100 {
+			return invalidf("Значение %d: процент должен быть от 0 до 100", i+1)
+		}
+		values[i] = v
+		sum += v
+	}
+	if !opts.Independent {
+		if sum > 100+opts.Tolerance {
+			return invalidf("Сумма значений %s%% больше 100%%", formatNumberRu(sum, opts.Decimals))
+		}
+		// Несколько долей одного целого должны в сумме давать 100%
+		if len(segments) > 1 && math.Abs(sum-100) > opts.Tolerance {
+			return invalidf("Сумма значений %s%% должна быть равна 100%%", formatNumberRu(sum, opts.Decimals))
+		}
+	}
+
+	start := 0.0
+	for i, seg := range segments {
+		seg["percent"] = values[i]
+		seg["percentText"] = formatNumberRu(values[i], opts.Decimals) + "%"
+		if !opts.Independent {
+			seg["start"] = start
+			start += values[i]
+		}
+		color := toString(seg["color"])
+		if color == "" && i < len(opts.Colors) {
+			color = opts.Colors[i]
+		}
+		if color != "" {
+			c, err := hexToColor(color)
+			if err != nil {
+				return invalidf("Значение %d: %v", i+1, err)
+			}
+			seg["rgb"] = c
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Настройки линейных, волновых и залитых графиков (options в схеме шаблона)
+type seriesOptions struct {
+	Series     int     `json:"series"`     // сколько линий в шаблоне: 1 или 2 (сравнение)
+	Points     int     `json:"points"`     // сколько точек на графике в шаблоне
+	Height     float64 `json:"height"`     // высота области графика в пикселях
+	Ticks      int     `json:"ticks"`      // сколько подписей на оси значений
+	Cumulative bool    `json:"cumulative"` // график с накоплением (4.1)
+	DateFormat string  `json:"dateFormat"` // формат подписи точки (Go layout), по умолчанию 02.01.2006
+	Decimals   int     `json:"decimals"`
+}
+
+var seriesDateLayouts = []string{
+	"2006-01-02",
+	"02.01.2006",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"01.2006",
+	"2006-01",
+}
+
+// parseSeriesDate разбирает дату точки. Голый год ("2024") неотличим от числа,
+// поэтому принимается только при bareYear: в поле date точки это точно дата,
+// а в импортируемой таблице — только если так говорит заголовок колонки.
+func parseSeriesDate(s string, bareYear bool) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range seriesDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	if bareYear {
+		if t, err := time.Parse("2006", s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("не удалось распознать дату %q", s)
+}
+
+type seriesPoint struct {
+	x     float64 // unix-время или номер точки, если дат нет
+	value float64
+}
+
+// parseSeries читает точки одной линии, сортирует их по дате и при необходимости накапливает
+func parseSeries(raw []interface{}, cumulative bool) ([]seriesPoint, bool, error) {
+	var points []seriesPoint
+	hasDates := true
+	for i, pRaw := range raw {
+		p, _ := pRaw.(map[string]interface{})
+		v, ok := toFloat(p["value"])
+		if !ok {
+			return nil, false, fmt.Errorf("точка %d: ожидается число", i+1)
+		}
+		pt := seriesPoint{x: float64(i), value: v}
+		if ds := toString(p["date"]); ds != "" {
+			d, err := parseSeriesDate(ds, true)
+			if err != nil {
+				return nil, false, fmt.Errorf("точка %d: %v", i+1, err)
+			}
+			pt.x = float64(d.Unix())
+		} else {
+			hasDates = false
+		}
+		points = append(points, pt)
+	}
+	if hasDates {
+		sort.SliceStable(points, func(i, j int) bool { return points[i].x < points[j].x })
+	} else {
+		// Без дат (или не у всех точек) — идём по порядку
+		for i := range points {
+			points[i].x = float64(i)
+		}
+	}
+	if cumulative {
+		sum := 0.0
+		for i := range points {
+			sum += points[i].value
+			points[i].value = sum
+		}
+	}
+	return points, hasDates, nil
+}
+
+// interpolate возвращает значение линии в точке x (линейная интерполяция)
+func interpolate(points []seriesPoint, x float64) float64 {
+	if x <= points[0].x {
+		return points[0].value
+	}
+	for i := 1; i < len(points); i++ {
+		if x <= points[i].x {
+			a, b := points[i-1], points[i]
+			if b.x == a.x {
+				return b.value
+			}
+			return a.value + (b.value-a.value)*(x-a.x)/(b.x-a.x)
+		}
+	}
+	return points[len(points)-1].value
+}
+
+// niceStep округляет шаг оси до 1, 2 или 5 × 10^n
+func niceStep(raw float64) float64 {
+	if raw <= 0 {
+		return 1
+	}
+	exp := math.Pow(10, math.Floor(math.Log10(raw)))
+	f := raw / exp
+	switch {
+	case f <= 1:
+		f = 1
+	case f <= 2:
+		f = 2
+	case f <= 5:
+		f = 5
+	default:
+		f = 10
+	}
+	return f * exp
+}
+
+// buildSeriesParams готовит chart_series: приводит линии к числу точек шаблона,
+// считает границы оси и высоты точек.
+//
+// params: {"series": [{"name": "...", "points": [{"date": "2024-01-31", "value": 12.5}, ...]}]}
+// Результат: params["points"] — [{label, y1, valueText1, y2, valueText2}],
+// axisLabel1..N, minText, maxText, seriesName1..2.
+func buildSeriesParams(schema *TemplateSchema, params map[string]interface{}) error {
+	opts := seriesOptions{Series: 1, Points: 10, Height: 500, Ticks: 5, DateFormat: "02.01.2006", Decimals: -1}
+	if err := schema.decodeOptions(&opts); err != nil {
+		return err
+	}
+	if opts.Points < 2 || opts.Ticks < 2 {
+		return fmt.Errorf("Ошибка в настройках шаблона: points и ticks должны быть не меньше 2")
+	}
+
+	series := groupItems(params, "series")
+	if len(series) != opts.Series {
+		return invalidf("Шаблон рассчитан на линий — %d, передано %d", opts.Series, len(series))
+	}
+
+	lines := make([][]seriesPoint, len(series))
+	withDates := true
+	for i, s := range series {
+		raw, _ := s["points"].([]interface{})
+		if len(raw) < 2 {
+			return invalidf("Линия %d: нужно минимум 2 точки", i+1)
+		}
+		pts, hasDates, err := parseSeries(raw, opts.Cumulative)
+		if err != nil {
+			return invalidf("Линия %d, %v", i+1, err)
+		}
+		lines[i] = pts
+		withDates = withDates && hasDates
+		params["seriesName"+strconv.Itoa(i+1)] = toString(s["name"])
+	}
+	if !withDates {
+		// Без дат каждая линия растягивается на всю ширину графика
+		for _, l := range lines {
+			for j := range l {
+				l[j].x = float64(j) / float64(len(l)-1)
+			}
+		}
+	}
+
+	// Общий диапазон по X для всех линий
+	from, to := lines[0][0].x, lines[0][len(lines[0])-1].x
+	for _, l := range lines[1:] {
+		from = math.Min(from, l[0].x)
+		to = math.Max(to, l[len(l)-1].x)
+	}
+
+	resampled := make([][]float64, len(lines))
+	minV, maxV := math.Inf(1), math.Inf(-1)
+	xs := make([]float64, opts.Points)
+	for k := range xs {
+		xs[k] = from + (to-from)*float64(k)/float64(opts.Points-1)
+	}
+	for i, l := range lines {
+		for _, x := range xs {
+			v := interpolate(l, x)
+			resampled[i] = append(resampled[i], v)
+			minV = math.Min(minV, v)
+			maxV = math.Max(maxV, v)
+		}
+	}
+
+	// Ось значений: от 0 (если всё положительное) до «круглого» максимума
+	if minV > 0 {
+		minV = 0
+	}
+	step := niceStep((maxV - minV) / float64(opts.Ticks-1))
+	axisMin := math.Floor(minV/step) * step
+	axisMax := axisMin + step*float64(opts.Ticks-1)
+	for axisMax < maxV {
+		axisMax += step
+	}
+	for t := 0; t < opts.Ticks; t++ {
+		v := axisMin + (axisMax-axisMin)*float64(t)/float64(opts.Ticks-1)
+		params["axisLabel"+strconv.Itoa(t+1)] = formatNumberRu(v, opts.Decimals)
+	}
+	params["minText"] = formatNumberRu(axisMin, opts.Decimals)
+	params["maxText"] = formatNumberRu(axisMax, opts.Decimals)
+
+	points := make([]interface{}, opts.Points)
+	for k, x := range xs {
+		p := map[string]interface{}{}
+		if withDates {
+			p["label"] = time.Unix(int64(x), 0).UTC().Format(opts.DateFormat)
+		} else {
+			p["label"] = strconv.Itoa(k + 1)
+		}
+		for i := range resampled {
+			n := strconv.Itoa(i + 1)
+			v := resampled[i][k]
+			p["y"+n] = (v - axisMin) / (axisMax - axisMin) * opts.Height
+			p["valueText"+n] = formatNumberRu(v, opts.Decimals)
+		}
+		points[k] = p
+	}
+	params["points"] = points
+	return nil
+}
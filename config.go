@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Настройки сервера. Источники по возрастанию приоритета: значения по умолчанию,
+// JSON-файл (-config, CONFIG или ./config.json, если он есть), переменные окружения, флаги.
+// Пустые пути к каталогам считаются от root, поэтому на рабочей станции с рендером
+// обычно достаточно root, а на стенде — root и nexrender_url.
+type Config struct {
+	Listen    string `json:"listen"`     // адрес HTTP-сервера, ":8080"
+	PublicURL string `json:"public_url"` // адрес сервера для воркеров Nexrender (вебхуки)
+
+	DBPath    string `json:"db_path"`
+	StaticDir string `json:"static_dir"`
+
+	Root           string `json:"root"`             // общий корень папок с шаблонами, файлами и видео
+	TemplatesDir   string `json:"templates_dir"`    // .aep (в templates.aep_path — пути относительно неё)
+	InputDir       string `json:"input_dir"`        // загруженные файлы задач, у каждой задачи своя папка
+	InputRetention string `json:"input_retention"`  // сколько хранить файлы задачи с ошибкой для перезапуска, "72h"
+	OutputDir      string `json:"output_dir"`       // готовые видео, раздаются по /output/
+	MarketWatchDir string `json:"market_watch_dir"` // биржевые файлы, см. birzha.go
+	GazetteerPath  string `json:"gazetteer_path"`   // справочник координат, см. map.go
+
+	RenderBackend string `json:"render_backend"` // nexrender или fake
+	NexrenderURL  string `json:"nexrender_url"`
+	WebhookSecret string `json:"webhook_secret"` // пусто — случайный на время работы процесса
+}
+
+// cfg — текущие настройки; до loadConfig в нём значения по умолчанию
+var cfg = defaultConfig()
+
+func defaultConfig() *Config {
+	return &Config{
+		Listen:         ":8080",
+		PublicURL:      "http://localhost:8080",
+		DBPath:         "./templates.db",
+		StaticDir:      "./static",
+		Root:           "C:/Users/Yarik/Downloads/DIPLOMA",
+		RenderBackend:  "nexrender",
+		NexrenderURL:   "http://localhost:3000",
+		InputRetention: "72h",
+	}
+}
+
+// Переменные окружения для полей Config
+var configEnv = []struct {
+	name  string
+	field func(c *Config) *string
+}{
+	{"LISTEN", func(c *Config) *string { return &c.Listen }},
+	{"PUBLIC_URL", func(c *Config) *string { return &c.PublicURL }},
+	{"DB_PATH", func(c *Config) *string { return &c.DBPath }},
+	{"STATIC_DIR", func(c *Config) *string { return &c.StaticDir }},
+	{"ROOT_DIR", func(c *Config) *string { return &c.Root }},
+	{"TEMPLATES_DIR", func(c *Config) *string { return &c.TemplatesDir }},
+	{"INPUT_DIR", func(c *Config) *string { return &c.InputDir }},
+	{"INPUT_RETENTION", func(c *Config) *string { return &c.InputRetention }},
+	{"OUTPUT_DIR", func(c *Config) *string { return &c.OutputDir }},
+	{"MARKET_WATCH_DIR", func(c *Config) *string { return &c.MarketWatchDir }},
+	{"GAZETTEER_PATH", func(c *Config) *string { return &c.GazetteerPath }},
+	{"RENDER_BACKEND", func(c *Config) *string { return &c.RenderBackend }},
+	{"NEXRENDER_URL", func(c *Config) *string { return &c.NexrenderURL }},
+	{"WEBHOOK_SECRET", func(c *Config) *string { return &c.WebhookSecret }},
+}
+
+// loadConfig собирает настройки из файла, окружения и флагов командной строки и проверяет их
+func loadConfig(args []string) (*Config, error) {
+	fset := flag.NewFlagSet("main_site", flag.ContinueOnError)
+	configPath := fset.String("config", os.Getenv("CONFIG"), "JSON-файл с настройками (по умолчанию ./config.json, если есть)")
+	// Флаги разбираем в отдельную структуру: применяются они после файла и окружения
+	var fl Config
+	fset.StringVar(&fl.Listen, "listen", "", "адрес HTTP-сервера (:8080)")
+	fset.StringVar(&fl.PublicURL, "public-url", "", "адрес сервера для вебхуков Nexrender")
+	fset.StringVar(&fl.DBPath, "db", "", "путь к templates.db")
+	fset.StringVar(&fl.Root, "root", "", "корень папок templates, input, output")
+	fset.StringVar(&fl.TemplatesDir, "templates", "", "папка с .aep")
+	fset.StringVar(&fl.InputDir, "input", "", "папка для загруженных файлов")
+	fset.StringVar(&fl.OutputDir, "output", "", "папка для готовых видео")
+	fset.StringVar(&fl.RenderBackend, "backend", "", "бэкенд рендера: nexrender или fake")
+	fset.StringVar(&fl.NexrenderURL, "nexrender", "", "адрес nexrender-server")
+	if err := fset.Parse(args); err != nil {
+		return nil, err
+	}
+
+	c := defaultConfig()
+	path, required := *configPath, true
+	if path == "" {
+		path, required = "config.json", false
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, c); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		log.Println("Настройки прочитаны из", path)
+	case required || !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	for _, e := range configEnv {
+		if v := os.Getenv(e.name); v != "" {
+			*e.field(c) = v
+		}
+	}
+	for _, e := range configEnv {
+		if v := *e.field(&fl); v != "" {
+			*e.field(c) = v
+		}
+	}
+
+	c.fillDefaults()
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// fillDefaults выводит незаданные пути из root
+func (c *Config) fillDefaults() {
+	for _, d := range []struct {
+		field *string
+		name  string
+	}{
+		{&c.TemplatesDir, "templates"},
+		{&c.InputDir, "input"},
+		{&c.OutputDir, "output"},
+		{&c.MarketWatchDir, "birzha"},
+		{&c.GazetteerPath, "gazetteer.csv"},
+	} {
+		if *d.field == "" && c.Root != "" {
+			*d.field = filepath.ToSlash(filepath.Join(c.Root, d.name))
+		}
+	}
+	c.PublicURL = strings.TrimRight(c.PublicURL, "/")
+	c.NexrenderURL = strings.TrimRight(c.NexrenderURL, "/")
+}
+
+// inputRetention — InputRetention как длительность (проверена в validate)
+func (c *Config) inputRetention() time.Duration {
+	d, err := time.ParseDuration(c.InputRetention)
+	if err != nil || d <= 0 {
+		return 72 * time.Hour
+	}
+	return d
+}
+
+// validate проверяет настройки при старте, чтобы сервер не падал на первой же задаче
+func (c *Config) validate() error {
+	var errs []string
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+		fail("listen %q: %v", c.Listen, err)
+	}
+	for name, v := range map[string]string{"public_url": c.PublicURL, "nexrender_url": c.NexrenderURL} {
+		u, err := url.Parse(v)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail("%s %q: нужен адрес вида http://host:port", name, v)
+		}
+	}
+	if d, err := time.ParseDuration(c.InputRetention); err != nil || d <= 0 {
+		fail("input_retention %q: нужна длительность вида 72h", c.InputRetention)
+	}
+	if c.RenderBackend != "nexrender" && c.RenderBackend != "fake" {
+		fail("render_backend %q: должен быть nexrender или fake", c.RenderBackend)
+	}
+
+	if _, err := os.Stat(c.DBPath); err != nil {
+		fail("db_path: %v", err)
+	}
+	if fi, err := os.Stat(c.StaticDir); err != nil || !fi.IsDir() {
+		fail("static_dir %q: папка не найдена", c.StaticDir)
+	}
+	// Без шаблонов не соберётся ни одна задача; fake-бэкенд .aep не открывает
+	if fi, err := os.Stat(c.TemplatesDir); (err != nil || !fi.IsDir()) && c.RenderBackend != "fake" {
+		fail("templates_dir %q: папка не найдена", c.TemplatesDir)
+	}
+	// В input и output пишет сам сервер — создаём их, если нет
+	for name, dir := range map[string]string{"input_dir": c.InputDir, "output_dir": c.OutputDir} {
+		if dir == "" {
+			fail("%s: не задан (и не задан root)", name)
+		} else if err := os.MkdirAll(dir, 0755); err != nil {
+			fail("%s: %v", name, err)
+		}
+	}
+	// Биржевые файлы и справочник координат нужны не всем шаблонам
+	if _, err := os.Stat(c.MarketWatchDir); err != nil {
+		log.Printf("Внимание: market_watch_dir %q недоступна, котировки из файлов не загружаются", c.MarketWatchDir)
+	}
+	if _, err := os.Stat(c.GazetteerPath); err != nil {
+		log.Printf("Внимание: gazetteer_path %q недоступен, карты без справочника координат", c.GazetteerPath)
+	}
+
+	if c.WebhookSecret == "" {
+		b := make([]byte, 16)
+		_, _ = rand.Read(b)
+		c.WebhookSecret = hex.EncodeToString(b)
+		log.Println("WEBHOOK_SECRET не задан, используется случайный токен")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("ошибки в настройках:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
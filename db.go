@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"strings"
+)
+
+// Схемы полей и пути к .aep шаблонов лежат текстом в schemas/<id шаблона>.json
+// и при старте переносятся в templates (seedTemplateSchemas).
+//
+//go:embed schemas/*.json
+var schemaSeeds embed.FS
+
+// migrateDB доводит структуру templates.db до актуальной: добавляет недостающие
+// колонки и таблицы. Вызывается один раз при старте сервера.
+func migrateDB() error {
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Схема полей шаблона (JSON), см. schema.go
+	if err := ensureColumn(db, "templates", "field_schema", "TEXT"); err != nil {
+		return err
+	}
+	// Хэш файла из schemas/, который последним записан в шаблон
+	if err := ensureColumn(db, "templates", "schema_seed", "TEXT"); err != nil {
+		return err
+	}
+	if err := seedTemplateSchemas(db); err != nil {
+		return err
+	}
+	// Части сюжета ссылаются на запись самого сюжета, см. sequence.go
+	if err := ensureColumn(db, "render_history", "parent_id", "INTEGER"); err != nil {
+		return err
+	}
+	// Когда задача последний раз сама сообщила о себе вебхуком, см. webhook.go
+	if err := ensureColumn(db, "render_history", "reported_at", "DATETIME"); err != nil {
+		return err
+	}
+	// Причина и срок блокировки пользователя, см. accounts.go
+	if err := ensureColumn(db, "users", "block_reason", "TEXT"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "users", "block_until", "DATETIME"); err != nil {
+		return err
+	}
+	// Сессии пользователей, см. sessions.go
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS sessions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		token_hash TEXT NOT NULL UNIQUE,
+		username TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		ip TEXT,
+		user_agent TEXT
+	)`)
+	if err != nil {
+		return err
+	}
+	// Последние котировки из папки биржевых файлов, см. birzha.go
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS market_data (
+		region TEXT PRIMARY KEY,
+		data TEXT NOT NULL,
+		loaded_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return err
+	}
+	// Итоги «за всё время» для демилитаризации, см. demilit.go
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS demilit_totals (
+		counter TEXT PRIMARY KEY,
+		total INTEGER NOT NULL DEFAULT 0,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return err
+	}
+	// Сутки, чья сводка уже прибавлена к demilit_totals
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS demilit_published (
+		report_date TEXT PRIMARY KEY,
+		published_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	return err
+}
+
+// seedTemplateSchemas записывает в шаблоны схемы и пути к .aep из schemas/.
+// Файл применяется, только если он изменился с прошлого раза: правка схемы
+// в админке действует до следующего изменения файла этого шаблона.
+// Если в файле есть template (name, category, preview_path), а шаблона с таким id
+// в каталоге нет, он создаётся — так заводятся служебные шаблоны вроде перехода сюжета.
+func seedTemplateSchemas(db *sql.DB) error {
+	entries, err := fs.ReadDir(schemaSeeds, "schemas")
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		id := strings.TrimSuffix(e.Name(), ".json")
+		data, err := schemaSeeds.ReadFile("schemas/" + e.Name())
+		if err != nil {
+			return err
+		}
+		var seed struct {
+			Template *struct {
+				Name        string `json:"name"`
+				Category    string `json:"category"`
+				PreviewPath string `json:"preview_path"`
+			} `json:"template"`
+			AepPath     string          `json:"aep_path"`
+			FieldSchema json.RawMessage `json:"field_schema"`
+		}
+		if err := json.Unmarshal(data, &seed); err != nil {
+			return fmt.Errorf("schemas/%s: %v", e.Name(), err)
+		}
+		var schema TemplateSchema
+		if err := json.Unmarshal(seed.FieldSchema, &schema); err != nil {
+			return fmt.Errorf("schemas/%s: %v", e.Name(), err)
+		}
+		if err := validateSchema(&schema); err != nil {
+			return fmt.Errorf("schemas/%s: %v", e.Name(), err)
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, seed.FieldSchema); err != nil {
+			return err
+		}
+		if t := seed.Template; t != nil {
+			_, err := db.Exec("INSERT OR IGNORE INTO templates (id, name, category, preview_path, description) VALUES (?, ?, ?, ?, '')",
+				id, t.Name, t.Category, t.PreviewPath)
+			if err != nil {
+				return err
+			}
+		}
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])
+		res, err := db.Exec(`UPDATE templates SET field_schema = ?, aep_path = COALESCE(NULLIF(?, ''), aep_path), schema_seed = ?
+			WHERE id = ? AND COALESCE(schema_seed, '') != ?`, compact.String(), seed.AepPath, hash, id, hash)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			log.Printf("Шаблон %s: схема загружена из schemas/%s", id, e.Name())
+		}
+	}
+	return nil
+}
+
+// ensureColumn добавляет колонку в таблицу, если её там ещё нет
+func ensureColumn(db *sql.DB, table, column, decl string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, typ string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	rows.Close()
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, decl))
+	return err
+}
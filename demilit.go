@@ -0,0 +1,260 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Демилитаризация (шаблоны 21.x): «за сутки / за всё время»
+
+type demilitCounter struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+}
+
+type demilitOptions struct {
+	Counters []demilitCounter `json:"counters"`
+	// Композиции вариантов: {"day": "...", "night": "..."}, по умолчанию — composition схемы
+	Variants       map[string]string `json:"variants"`
+	DefaultVariant string            `json:"defaultVariant"`
+}
+
+func loadDemilitTotals(db *sql.DB) (map[string]int64, error) {
+	rows, err := db.Query("SELECT counter, total FROM demilit_totals")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	totals := make(map[string]int64)
+	for rows.Next() {
+		var key string
+		var total int64
+		if err := rows.Scan(&key, &total); err != nil {
+			return nil, err
+		}
+		totals[key] = total
+	}
+	return totals, nil
+}
+
+// demilitPublished — опубликована ли уже сводка за date
+func demilitPublished(db *sql.DB, date string) (bool, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM demilit_published WHERE report_date = ?", date).Scan(&n)
+	return n > 0, err
+}
+
+// buildDemilitParams прибавляет суточные значения к последним опубликованным итогам.
+//
+// params: {"variant": "night", "reportDate": "2025-06-01", "daily": {"aircraft": 1, "tanks": 12, ...}}
+// reportDate — за какие сутки сводка (по умолчанию сегодня). Посчитанные итоги сохраняются в params["totals"]
+// (от клиента они не принимаются, см. taskServerParams): при перезапуске рендера они не пересчитываются.
+// Если сводка за эти сутки уже опубликована (например, вышел дневной вариант, а теперь делают ночной),
+// суточные значения в итогах уже учтены и второй раз не прибавляются.
+func buildDemilitParams(schema *TemplateSchema, params map[string]interface{}) error {
+	var opts demilitOptions
+	if err := schema.decodeOptions(&opts); err != nil {
+		return err
+	}
+	if len(opts.Counters) == 0 {
+		return fmt.Errorf("Ошибка в настройках шаблона: не заданы counters")
+	}
+
+	// Вариант день/ночь — другая композиция в том же проекте
+	variant := toString(params["variant"])
+	if variant == "" {
+		variant = opts.DefaultVariant
+	}
+	if variant != "" {
+		comp, ok := opts.Variants[variant]
+		if !ok {
+			return invalidf("Неизвестный вариант %q", variant)
+		}
+		for i := range schema.Fields {
+			schema.Fields[i].Composition = strings.Replace(schema.Fields[i].Composition, schema.Composition, comp, 1)
+		}
+		schema.Composition = comp
+		params["variant"] = variant
+	}
+
+	reportDate := toString(params["reportDate"])
+	if reportDate == "" {
+		reportDate = time.Now().Format("2006-01-02")
+	}
+	if _, err := time.Parse("2006-01-02", reportDate); err != nil {
+		return invalidf("Дата сводки %q: ожидается ГГГГ-ММ-ДД", reportDate)
+	}
+	params["reportDate"] = reportDate
+
+	daily, _ := params["daily"].(map[string]interface{})
+	if daily == nil {
+		return invalidf("Не переданы значения за сутки")
+	}
+	values := make(map[string]int64)
+	for _, c := range opts.Counters {
+		if raw := daily[c.Key]; raw != nil && raw != "" {
+			v, ok := toFloat(raw)
+			if !ok || v < 0 || v != math.Trunc(v) {
+				return invalidf("%s: за сутки ожидается целое неотрицательное число", c.Label)
+			}
+			values[c.Key] = int64(v)
+		}
+	}
+
+	totals, _ := params["totals"].(map[string]interface{})
+	if totals == nil {
+		db, err := sql.Open("sqlite3", cfg.DBPath)
+		if err != nil {
+			return err
+		}
+		last, err := loadDemilitTotals(db)
+		var published bool
+		if err == nil {
+			published, err = demilitPublished(db, reportDate)
+		}
+		db.Close()
+		if err != nil {
+			return fmt.Errorf("Ошибка чтения итогов: %v", err)
+		}
+		totals = make(map[string]interface{})
+		for _, c := range opts.Counters {
+			t := last[c.Key]
+			if !published {
+				t += values[c.Key]
+			}
+			totals[c.Key] = float64(t)
+		}
+		params["totals"] = totals
+	}
+
+	var counters []interface{}
+	for _, c := range opts.Counters {
+		d := float64(values[c.Key])
+		t, _ := toFloat(totals[c.Key])
+		dailyText := formatNumberRu(d, 0)
+		if d > 0 {
+			dailyText = "+" + dailyText
+		}
+		counters = append(counters, map[string]interface{}{
+			"key":       c.Key,
+			"label":     c.Label,
+			"dailyText": dailyText,
+			"totalText": formatNumberRu(t, 0),
+		})
+	}
+	params["counters"] = counters
+	return nil
+}
+
+// publishDemilitTotals прибавляет к итогам суточные значения готовой сводки.
+// Счётчики берутся из params["totals"] — их посчитал buildDemilitParams по настройкам шаблона.
+// Сутки засчитываются один раз: дата отмечается в demilit_published в той же транзакции,
+// поэтому второй вариант (день/ночь) или повторно отправленная сводка за ту же дату итоги не меняют.
+func publishDemilitTotals(params map[string]interface{}) error {
+	totals, _ := params["totals"].(map[string]interface{})
+	daily, _ := params["daily"].(map[string]interface{})
+	if len(totals) == 0 || daily == nil {
+		return nil
+	}
+	reportDate := toString(params["reportDate"])
+	if reportDate == "" {
+		return fmt.Errorf("Не указана дата сводки")
+	}
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("INSERT OR IGNORE INTO demilit_published (report_date) VALUES (?)", reportDate)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		log.Printf("Сводка демилитаризации за %s уже опубликована, итоги не меняются", reportDate)
+		return nil
+	}
+	for key := range totals {
+		d, _ := toFloat(daily[key])
+		if d <= 0 {
+			continue
+		}
+		_, err := tx.Exec(`INSERT INTO demilit_totals (counter, total, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(counter) DO UPDATE SET total = total + excluded.total, updated_at = excluded.updated_at`, key, int64(d))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// setDemilitTotals записывает итоги как есть (ручная правка)
+func setDemilitTotals(db *sql.DB, totals map[string]int64) error {
+	for key, t := range totals {
+		_, err := db.Exec(`INSERT INTO demilit_totals (counter, total, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(counter) DO UPDATE SET total = excluded.total, updated_at = excluded.updated_at`, key, t)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Текущие итоги «за всё время».
+// GET — для формы; POST {"aircraft": 123, ...} — ручная правка (ТОЛЬКО для админа!)
+func demilitTotalsHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		writeJsonError(w, "DB error", 500)
+		return
+	}
+	defer db.Close()
+
+	switch r.Method {
+	case http.MethodGet:
+		totals, err := loadDemilitTotals(db)
+		if err != nil {
+			writeJsonError(w, "DB error", 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(totals)
+	case http.MethodPost:
+		if !user.IsAdmin() {
+			writeJsonError(w, "Forbidden", 403)
+			return
+		}
+		var req map[string]int64
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJsonError(w, "Bad request", 400)
+			return
+		}
+		for _, v := range req {
+			if v < 0 {
+				writeJsonError(w, "Итог не может быть отрицательным", 400)
+				return
+			}
+		}
+		if err := setDemilitTotals(db, req); err != nil {
+			writeJsonError(w, "DB error", 500)
+			return
+		}
+		log.Printf("Итоги демилитаризации исправлены вручную (%s): %v", user.Username, req)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"result": "ok"})
+	default:
+		writeJsonError(w, "Method not allowed", 405)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useTestDB подменяет cfg.DBPath на мигрированную копию templates.db
+func useTestDB(t *testing.T) {
+	t.Helper()
+	data, err := os.ReadFile("templates.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbPath := filepath.Join(t.TempDir(), "templates.db")
+	if err := os.WriteFile(dbPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldCfg := cfg
+	testCfg := *cfg
+	testCfg.DBPath = dbPath
+	cfg = &testCfg
+	t.Cleanup(func() { cfg = oldCfg })
+	if err := migrateDB(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func demilitTanks(t *testing.T) int64 {
+	t.Helper()
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	totals, err := loadDemilitTotals(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return totals["tanks"]
+}
+
+// buildDemilit собирает params сводки за date с 12 танками за сутки
+func buildDemilit(t *testing.T, variant, date string) map[string]interface{} {
+	t.Helper()
+	schema, err := loadTemplateSchema("80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := map[string]interface{}{
+		"variant":    variant,
+		"reportDate": date,
+		"daily":      map[string]interface{}{"tanks": float64(12)},
+	}
+	if err := buildDemilitParams(schema, params); err != nil {
+		t.Fatal(err)
+	}
+	return params
+}
+
+// Дневной и ночной варианты одной сводки прибавляются к итогам один раз
+func TestDemilitVariantsPublishOnce(t *testing.T) {
+	useTestDB(t)
+	base := demilitTanks(t)
+
+	day := buildDemilit(t, "day", "2025-06-01")
+	night := buildDemilit(t, "night", "2025-06-01")
+	for _, p := range []map[string]interface{}{day, night} {
+		if got := p["totals"].(map[string]interface{})["tanks"]; got != float64(base+12) {
+			t.Fatalf("%s: итог %v, ожидается %d", p["variant"], got, base+12)
+		}
+		if err := publishDemilitTotals(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := demilitTanks(t); got != base+12 {
+		t.Fatalf("после двух вариантов итог %d, ожидается %d", got, base+12)
+	}
+
+	// Сводка за уже опубликованные сутки показывает те же итоги
+	again := buildDemilit(t, "night", "2025-06-01")
+	if got := again["totals"].(map[string]interface{})["tanks"]; got != float64(base+12) {
+		t.Fatalf("повторная сводка: итог %v, ожидается %d", got, base+12)
+	}
+	if err := publishDemilitTotals(again); err != nil {
+		t.Fatal(err)
+	}
+
+	next := buildDemilit(t, "day", "2025-06-02")
+	if err := publishDemilitTotals(next); err != nil {
+		t.Fatal(err)
+	}
+	if got := demilitTanks(t); got != base+24 {
+		t.Fatalf("после следующих суток итог %d, ожидается %d", got, base+24)
+	}
+}
+
+func TestDemilitReportDate(t *testing.T) {
+	useTestDB(t)
+	schema, err := loadTemplateSchema("80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := map[string]interface{}{"reportDate": "01.06.2025", "daily": map[string]interface{}{}}
+	if err := buildDemilitParams(schema, params); errorStatus(err) != 400 {
+		t.Fatalf("дата 01.06.2025: ожидается ошибка валидации, получено %v", err)
+	}
+}
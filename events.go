@@ -0,0 +1,199 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Живой прогресс рендеров (Server-Sent Events). Всё, что меняет статус или прогресс
+// записи render_history (вебхуки, опрос Nexrender, сюжеты, отмена, перезапуск), вызывает
+// notifyRender, а /api/render-events рассылает изменения открытым страницам:
+// пользователю — его задачи, админу — все.
+//
+// id событий растут монотонно; последние renderEventsKept хранятся в памяти, и браузер,
+// переподключаясь с Last-Event-ID, получает пропущенное. Если пропущенного уже нет
+// (давно отключался или сервер перезапускался), приходит событие resync — перечитать историю целиком.
+
+const (
+	renderEventsKept      = 1000
+	renderEventsKeepalive = 25 * time.Second
+)
+
+// renderEvent — изменение записи render_history
+type renderEvent struct {
+	ID         int64   `json:"id"`
+	UID        string  `json:"uid"`
+	Username   string  `json:"username"`
+	Type       string  `json:"type"`
+	Status     string  `json:"status"`
+	Progress   float64 `json:"progress"`
+	OutputPath string  `json:"output_path,omitempty"`
+	ParentUID  string  `json:"parent_uid,omitempty"`
+}
+
+type renderSubscriber struct {
+	username string
+	admin    bool
+	ch       chan renderEvent
+}
+
+func (s *renderSubscriber) wants(ev renderEvent) bool {
+	return s.admin || s.username == ev.Username
+}
+
+// renderEventHub хранит хвост событий и подписчиков
+type renderEventHub struct {
+	mu     sync.Mutex
+	lastID int64
+	events []renderEvent
+	subs   map[*renderSubscriber]bool
+}
+
+// id начинаются с момента старта, чтобы после перезапуска сервера не совпасть со старыми
+var renderEvents = &renderEventHub{
+	lastID: time.Now().UnixMilli() * 1000,
+	subs:   make(map[*renderSubscriber]bool),
+}
+
+func (h *renderEventHub) publish(ev renderEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastID++
+	ev.ID = h.lastID
+	h.events = append(h.events, ev)
+	if len(h.events) > renderEventsKept {
+		h.events = h.events[len(h.events)-renderEventsKept:]
+	}
+	for s := range h.subs {
+		if !s.wants(ev) {
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		default:
+			// Не успевает читать — отключаем, браузер переподключится с Last-Event-ID
+			delete(h.subs, s)
+			close(s.ch)
+		}
+	}
+}
+
+// subscribe регистрирует подписчика и возвращает события после lastID и id последнего события.
+// ok == false — события после lastID уже вытеснены, нужен resync.
+func (h *renderEventHub) subscribe(s *renderSubscriber, lastID int64) (missed []renderEvent, current int64, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subs[s] = true
+	current = h.lastID
+	if lastID == 0 {
+		return nil, current, true
+	}
+	if lastID > h.lastID {
+		return nil, current, false
+	}
+	if len(h.events) > 0 && lastID < h.events[0].ID-1 {
+		return nil, current, false
+	}
+	if len(h.events) == 0 && lastID < h.lastID {
+		return nil, current, false
+	}
+	for _, ev := range h.events {
+		if ev.ID > lastID && s.wants(ev) {
+			missed = append(missed, ev)
+		}
+	}
+	return missed, current, true
+}
+
+func (h *renderEventHub) unsubscribe(s *renderSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[s] {
+		delete(h.subs, s)
+		close(s.ch)
+	}
+}
+
+// notifyRender читает запись render_history и рассылает её текущий статус
+func notifyRender(db *sql.DB, uid string) {
+	var ev renderEvent
+	var taskType, paramsStr, parentUID sql.NullString
+	err := db.QueryRow(`SELECT rh.uid, rh.username, rh.type, rh.status, rh.params, p.uid
+		FROM render_history rh LEFT JOIN render_history p ON p.id = rh.parent_id
+		WHERE rh.uid = ?`, uid).Scan(&ev.UID, &ev.Username, &taskType, &ev.Status, &paramsStr, &parentUID)
+	if err != nil {
+		log.Printf("RenderEvents: запись %s не прочитана: %v", uid, err)
+		return
+	}
+	ev.Type, ev.ParentUID = taskType.String, parentUID.String
+	var params map[string]interface{}
+	_ = json.Unmarshal([]byte(paramsStr.String), &params)
+	ev.Progress, _ = toFloat(params["progress"])
+	ev.OutputPath = toString(params["output_path"])
+	renderEvents.publish(ev)
+}
+
+// Поток изменений статусов рендера (text/event-stream)
+func renderEventsHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJsonError(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	lastID, _ := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+	sub := &renderSubscriber{username: user.Username, admin: user.IsAdmin(), ch: make(chan renderEvent, 64)}
+	missed, current, ok := renderEvents.subscribe(sub, lastID)
+	defer renderEvents.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if !ok {
+		fmt.Fprintf(w, "id: %d\nevent: resync\ndata: {}\n\n", current)
+	} else {
+		for _, ev := range missed {
+			writeRenderEvent(w, ev)
+		}
+		// id без data браузер не показывает как событие, но запоминает: переподключение
+		// до первого события всё равно продолжит отсюда, а не с пустым Last-Event-ID
+		fmt.Fprintf(w, "id: %d\n\n", current)
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(renderEventsKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev, open := <-sub.ch:
+			if !open {
+				return
+			}
+			writeRenderEvent(w, ev)
+			flusher.Flush()
+		case <-keepalive.C:
+			// Сессию могли завершить (выход, блокировка) — поток закрывается вместе с ней
+			if _, ok := sessionUser(user.Session); !ok {
+				return
+			}
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func writeRenderEvent(w http.ResponseWriter, ev renderEvent) {
+	data, _ := json.Marshal(ev)
+	fmt.Fprintf(w, "id: %d\nevent: render\ndata: %s\n\n", ev.ID, data)
+}
@@ -4,4 +4,4 @@ go 1.23.4
 
 require github.com/mattn/go-sqlite3 v1.14.28
 
-require golang.org/x/crypto v0.38.0 // indirect
+require golang.org/x/crypto v0.38.0
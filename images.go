@@ -0,0 +1,94 @@
+package main
+
+import (
+	"image"
+	"image/png"
+	"os"
+)
+
+// cropImageFile обрезает картинку по центру под пропорции width:height
+// и масштабирует её до этого размера. Файл перезаписывается в PNG.
+func cropImageFile(path string, width, height int) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	src, _, err := image.Decode(in)
+	in.Close()
+	if err != nil {
+		return err
+	}
+
+	b := src.Bounds()
+	cropW, cropH := b.Dx(), b.Dy()
+	// Сравниваем пропорции без деления: cropW/cropH против width/height
+	if cropW*height > cropH*width {
+		cropW = cropH * width / height
+	} else {
+		cropH = cropW * height / width
+	}
+	x0 := b.Min.X + (b.Dx()-cropW)/2
+	y0 := b.Min.Y + (b.Dy()-cropH)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	scaleBilinear(dst, src, image.Rect(x0, y0, x0+cropW, y0+cropH))
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return png.Encode(out, dst)
+}
+
+// scaleBilinear масштабирует область rect картинки src на весь dst
+func scaleBilinear(dst *image.RGBA, src image.Image, rect image.Rectangle) {
+	dw, dh := dst.Bounds().Dx(), dst.Bounds().Dy()
+	sw, sh := float64(rect.Dx()), float64(rect.Dy())
+	for y := 0; y < dh; y++ {
+		fy := (float64(y)+0.5)*sh/float64(dh) - 0.5
+		if fy < 0 {
+			fy = 0
+		}
+		y1 := int(fy)
+		y2 := y1 + 1
+		if y2 >= rect.Dy() {
+			y2 = rect.Dy() - 1
+		}
+		wy := fy - float64(y1)
+		for x := 0; x < dw; x++ {
+			fx := (float64(x)+0.5)*sw/float64(dw) - 0.5
+			if fx < 0 {
+				fx = 0
+			}
+			x1 := int(fx)
+			x2 := x1 + 1
+			if x2 >= rect.Dx() {
+				x2 = rect.Dx() - 1
+			}
+			wx := fx - float64(x1)
+
+			var c [4]float64
+			for _, p := range [4]struct {
+				x, y int
+				w    float64
+			}{
+				{x1, y1, (1 - wx) * (1 - wy)},
+				{x2, y1, wx * (1 - wy)},
+				{x1, y2, (1 - wx) * wy},
+				{x2, y2, wx * wy},
+			} {
+				r, g, bl, a := src.At(rect.Min.X+p.x, rect.Min.Y+p.y).RGBA()
+				c[0] += float64(r) * p.w
+				c[1] += float64(g) * p.w
+				c[2] += float64(bl) * p.w
+				c[3] += float64(a) * p.w
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(c[0] / 257)
+			dst.Pix[i+1] = uint8(c[1] / 257)
+			dst.Pix[i+2] = uint8(c[2] / 257)
+			dst.Pix[i+3] = uint8(c[3] / 257)
+		}
+	}
+}
@@ -0,0 +1,532 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Импорт данных для диаграмм из CSV/XLSX
+
+const importPreviewRows = 20
+
+type importedTable struct {
+	Headers []string
+	Rows    [][]string
+}
+
+type importColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type"` // number, date, text
+}
+
+// importMapping — какие колонки таблицы подставить в поля шаблона
+type importMapping struct {
+	Label  string   `json:"label"`  // подписи (сегменты, строки диаграммы)
+	Date   string   `json:"date"`   // даты для графиков
+	Value  string   `json:"value"`  // одно значение
+	Values []string `json:"values"` // несколько серий
+}
+
+func parseCSV(data []byte) (*importedTable, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	// Excel в русской локали сохраняет CSV через точку с запятой
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	r := csv.NewReader(bytes.NewReader(data))
+	if bytes.Count(firstLine, []byte(";")) > bytes.Count(firstLine, []byte(",")) {
+		r.Comma = ';'
+	}
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	return newImportedTable(records)
+}
+
+func newImportedTable(records [][]string) (*importedTable, error) {
+	if len(records) == 0 {
+		return nil, fmt.Errorf("файл пустой")
+	}
+	t := &importedTable{}
+	for i, h := range records[0] {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			h = fmt.Sprintf("Колонка %d", i+1)
+		}
+		t.Headers = append(t.Headers, h)
+	}
+	for _, rec := range records[1:] {
+		row := make([]string, len(t.Headers))
+		empty := true
+		for i := range row {
+			if i < len(rec) {
+				row[i] = strings.TrimSpace(rec[i])
+				empty = empty && row[i] == ""
+			}
+		}
+		if !empty {
+			t.Rows = append(t.Rows, row)
+		}
+	}
+	return t, nil
+}
+
+// --- XLSX: читаем первый лист через archive/zip и encoding/xml ---
+
+type xlsxWorkbook struct {
+	Props struct {
+		Date1904 bool `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRels struct {
+	Rels []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxSharedStrings struct {
+	Items []struct {
+		T    string `xml:"t"`
+		Runs []struct {
+			T string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"si"`
+}
+
+type xlsxStyles struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string `xml:"r,attr"`
+			Type   string `xml:"t,attr"`
+			Style  int    `xml:"s,attr"`
+			Value  string `xml:"v"`
+			Inline struct {
+				T string `xml:"t"`
+			} `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func readZipXML(zr *zip.Reader, name string, v interface{}) error {
+	for _, f := range zr.File {
+		if f.Name == name {
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+			return xml.NewDecoder(rc).Decode(v)
+		}
+	}
+	return fmt.Errorf("в файле нет %s", name)
+}
+
+// xlsxColumn переводит ссылку на ячейку ("AB12") в номер колонки с нуля
+func xlsxColumn(ref string) int {
+	col := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		col = col*26 + int(c-'A'+1)
+	}
+	return col - 1
+}
+
+func parseXLSX(data []byte) (*importedTable, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("это не xlsx-файл")
+	}
+
+	// Путь к первому листу: workbook.xml -> workbook.xml.rels
+	sheetPath := "xl/worksheets/sheet1.xml"
+	var wb xlsxWorkbook
+	var rels xlsxRels
+	if readZipXML(zr, "xl/workbook.xml", &wb) == nil && len(wb.Sheets) > 0 &&
+		readZipXML(zr, "xl/_rels/workbook.xml.rels", &rels) == nil {
+		for _, rel := range rels.Rels {
+			if rel.ID == wb.Sheets[0].ID {
+				if strings.HasPrefix(rel.Target, "/") {
+					sheetPath = strings.TrimPrefix(rel.Target, "/")
+				} else {
+					sheetPath = path.Join("xl", rel.Target)
+				}
+			}
+		}
+	}
+
+	var shared xlsxSharedStrings
+	_ = readZipXML(zr, "xl/sharedStrings.xml", &shared) // может отсутствовать
+	strs := make([]string, len(shared.Items))
+	for i, si := range shared.Items {
+		s := si.T
+		for _, r := range si.Runs {
+			s += r.T
+		}
+		strs[i] = s
+	}
+
+	// Даты в xlsx хранятся числом дней, датой их делает только формат ячейки
+	var styles xlsxStyles
+	_ = readZipXML(zr, "xl/styles.xml", &styles)
+	dateStyles := xlsxDateStyles(styles)
+
+	var sheet xlsxSheet
+	if err := readZipXML(zr, sheetPath, &sheet); err != nil {
+		return nil, err
+	}
+	var records [][]string
+	for _, row := range sheet.Rows {
+		var rec []string
+		for i, c := range row.Cells {
+			col := i
+			if c.Ref != "" {
+				col = xlsxColumn(c.Ref)
+			}
+			for len(rec) <= col {
+				rec = append(rec, "")
+			}
+			switch c.Type {
+			case "s":
+				if n, err := strconv.Atoi(c.Value); err == nil && n < len(strs) {
+					rec[col] = strs[n]
+				}
+			case "inlineStr":
+				rec[col] = c.Inline.T
+			default:
+				rec[col] = c.Value
+				if c.Style < len(dateStyles) && dateStyles[c.Style] {
+					if d, ok := excelSerialDate(c.Value, wb.Props.Date1904); ok {
+						rec[col] = d
+					}
+				}
+			}
+		}
+		records = append(records, rec)
+	}
+	return newImportedTable(records)
+}
+
+// xlsxDateStyles отмечает стили ячеек (индексы cellXfs), у которых формат числа — дата
+func xlsxDateStyles(styles xlsxStyles) []bool {
+	custom := make(map[int]string, len(styles.NumFmts))
+	for _, f := range styles.NumFmts {
+		custom[f.ID] = f.Code
+	}
+	dates := make([]bool, len(styles.CellXfs))
+	for i, xf := range styles.CellXfs {
+		if code, ok := custom[xf.NumFmtID]; ok {
+			dates[i] = isDateFormatCode(code)
+			continue
+		}
+		// Встроенные форматы дат: 14 m/d/yyyy, 15 d-mmm-yy, 16 d-mmm, 17 mmm-yy, 22 m/d/yy h:mm
+		switch xf.NumFmtID {
+		case 14, 15, 16, 17, 22:
+			dates[i] = true
+		}
+	}
+	return dates
+}
+
+// isDateFormatCode — есть ли в пользовательском формате день или год.
+// Текст в кавычках, экранированные символы и [цвет]/[$-419] не считаются.
+func isDateFormatCode(code string) bool {
+	quoted, bracket, escaped := false, false, false
+	for _, c := range strings.ToLower(code) {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted:
+			quoted = c != '"'
+		case bracket:
+			bracket = c != ']'
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = true
+		case c == '[':
+			bracket = true
+		case c == 'd' || c == 'y':
+			return true
+		}
+	}
+	return false
+}
+
+// excelSerialDate переводит число дней с 30.12.1899 (или с 01.01.1904) в дату,
+// а если есть доля дня — в дату со временем
+func excelSerialDate(s string, date1904 bool) (string, bool) {
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return "", false
+	}
+	base := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		base = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	t := base.Add(time.Duration(n * 24 * float64(time.Hour))).Round(time.Second)
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+		return t.Format("2006-01-02"), true
+	}
+	return t.Format("2006-01-02 15:04:05"), true
+}
+
+// isYearHeader — заголовок колонки говорит, что в ней годы или даты
+func isYearHeader(h string) bool {
+	for _, w := range strings.FieldsFunc(strings.ToLower(h), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		switch w {
+		case "год", "годы", "года", "year", "years", "дата", "date":
+			return true
+		}
+	}
+	return false
+}
+
+func detectColumnType(t *importedTable, col int) string {
+	bareYear := isYearHeader(t.Headers[col])
+	isNumber, isDate, filled := true, true, false
+	for _, row := range t.Rows {
+		v := row[col]
+		if v == "" {
+			continue
+		}
+		filled = true
+		if _, ok := toFloat(v); !ok {
+			isNumber = false
+		}
+		if _, err := parseSeriesDate(v, bareYear); err != nil {
+			isDate = false
+		}
+	}
+	switch {
+	case !filled:
+		return "text"
+	case isDate:
+		return "date"
+	case isNumber:
+		return "number"
+	}
+	return "text"
+}
+
+func (t *importedTable) column(name string) (int, error) {
+	for i, h := range t.Headers {
+		if h == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("нет колонки %q", name)
+}
+
+// mapImportedData раскладывает выбранные колонки в params для типа задачи шаблона
+func mapImportedData(taskType string, t *importedTable, m importMapping) (map[string]interface{}, error) {
+	valueCols := m.Values
+	if len(valueCols) == 0 && m.Value != "" {
+		valueCols = []string{m.Value}
+	}
+	if len(valueCols) == 0 {
+		return nil, fmt.Errorf("не выбрана колонка со значениями")
+	}
+	vIdx := make([]int, len(valueCols))
+	for i, name := range valueCols {
+		idx, err := t.column(name)
+		if err != nil {
+			return nil, err
+		}
+		vIdx[i] = idx
+	}
+	cell := func(row []string, col, line int) (float64, error) {
+		v, ok := toFloat(row[col])
+		if !ok {
+			return 0, fmt.Errorf("строка %d, колонка %q: %q — не число", line+2, t.Headers[col], row[col])
+		}
+		return v, nil
+	}
+
+	switch taskType {
+	case "chart_pie", "chart_donut":
+		lIdx, err := t.column(m.Label)
+		if err != nil {
+			return nil, err
+		}
+		var segments []interface{}
+		for i, row := range t.Rows {
+			v, err := cell(row, vIdx[0], i)
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, map[string]interface{}{"label": row[lIdx], "value": v})
+		}
+		return map[string]interface{}{"segments": segments}, nil
+
+	case "chart_bar":
+		lIdx, err := t.column(m.Label)
+		if err != nil {
+			return nil, err
+		}
+		var rows []interface{}
+		for i, row := range t.Rows {
+			var values []interface{}
+			for _, col := range vIdx {
+				v, err := cell(row, col, i)
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, v)
+			}
+			rows = append(rows, map[string]interface{}{"label": row[lIdx], "values": values})
+		}
+		var series []interface{}
+		for _, name := range valueCols {
+			series = append(series, name)
+		}
+		return map[string]interface{}{"series": series, "rows": rows}, nil
+
+	case "chart_series":
+		dIdx := -1
+		if m.Date != "" {
+			idx, err := t.column(m.Date)
+			if err != nil {
+				return nil, err
+			}
+			dIdx = idx
+		}
+		var series []interface{}
+		for s, col := range vIdx {
+			var points []interface{}
+			for i, row := range t.Rows {
+				if row[col] == "" {
+					continue // пропуски в данных
+				}
+				v, err := cell(row, col, i)
+				if err != nil {
+					return nil, err
+				}
+				p := map[string]interface{}{"value": v}
+				if dIdx >= 0 {
+					date := row[dIdx]
+					// Колонку выбрали как дату — голый год понимаем как 1 января
+					if d, err := parseSeriesDate(date, true); err == nil && len(date) == 4 {
+						date = d.Format("2006-01-02")
+					}
+					p["date"] = date
+				}
+				points = append(points, p)
+			}
+			series = append(series, map[string]interface{}{"name": valueCols[s], "points": points})
+		}
+		return map[string]interface{}{"series": series}, nil
+	}
+	return nil, fmt.Errorf("импорт данных для типа %q не поддерживается", taskType)
+}
+
+// Загрузка CSV/XLSX для диаграмм.
+// POST /api/import, multipart: file — таблица.
+// Без mapping возвращает колонки с типами и первые строки для предпросмотра;
+// с template и mapping (JSON) — ещё и готовые params для /save-task.
+func importDataHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		writeJsonError(w, "Ошибка обработки формы", http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeJsonError(w, "Файл не передан", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeJsonError(w, "Ошибка чтения файла", http.StatusBadRequest)
+		return
+	}
+
+	var table *importedTable
+	switch strings.ToLower(filepath.Ext(header.Filename)) {
+	case ".csv", ".txt":
+		table, err = parseCSV(data)
+	case ".xlsx":
+		table, err = parseXLSX(data)
+	default:
+		writeJsonError(w, "Поддерживаются только CSV и XLSX", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeJsonError(w, "Ошибка разбора файла: "+err.Error(), http.StatusBadRequest)
+		log.Println("Ошибка импорта:", err)
+		return
+	}
+
+	columns := make([]importColumn, len(table.Headers))
+	for i, h := range table.Headers {
+		columns[i] = importColumn{Name: h, Type: detectColumnType(table, i)}
+	}
+	preview := table.Rows
+	if len(preview) > importPreviewRows {
+		preview = preview[:importPreviewRows]
+	}
+	result := map[string]interface{}{
+		"columns":    columns,
+		"rows":       preview,
+		"total_rows": len(table.Rows),
+	}
+
+	if mappingRaw := r.FormValue("mapping"); mappingRaw != "" {
+		var mapping importMapping
+		if err := json.Unmarshal([]byte(mappingRaw), &mapping); err != nil {
+			writeJsonError(w, "Ошибка декодирования mapping", http.StatusBadRequest)
+			return
+		}
+		schema, err := loadTemplateSchema(r.FormValue("template"))
+		if err != nil {
+			writeJsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		params, err := mapImportedData(schema.Type, table, mapping)
+		if err != nil {
+			writeJsonError(w, "Ошибка сопоставления колонок: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		result["type"] = schema.Type
+		result["params"] = params
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
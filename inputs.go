@@ -0,0 +1,110 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Загруженные файлы каждой задачи лежат в своей папке cfg.InputDir/<id задачи>
+// (у сюжета — одна папка на все части), путь к ней — params.input_dir.
+// Так два редактора, отправившие задачи одновременно, не перезаписывают файлы друг друга.
+//
+// Когда папка больше не нужна:
+//   - задача готова (done) — сразу, если папкой не пользуется другая задача в работе;
+//   - ошибка или отмена — через cfg.InputRetention после отправки: до тех пор задачу можно перезапустить;
+//   - задача удалена или перезапущена — как только нет задач в работе с этой папкой;
+//   - папка без задачи (отправка не удалась) — через inputOrphanAge.
+// Проверяет всё это startInputJanitor, а готовые задачи освобождают папку сами (releaseInputDir).
+
+const (
+	inputJanitorInterval = time.Hour
+	inputOrphanAge       = time.Hour
+)
+
+// newInputDir создаёт папку для файлов задачи id
+func newInputDir(id string) (string, error) {
+	dir := filepath.Join(cfg.InputDir, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// inputDirInUse — есть ли задачи в работе с этой папкой
+func inputDirInUse(db *sql.DB, dir string) bool {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM render_history
+		WHERE json_extract(params, '$.input_dir') = ? AND status IN ('queued', 'rendering')`, dir).Scan(&n)
+	return err != nil || n > 0 // при ошибке БД лучше не удалять
+}
+
+// releaseInputDir удаляет папку с файлами готовой задачи uid, если она больше никому не нужна
+func releaseInputDir(db *sql.DB, uid string) {
+	var dir sql.NullString
+	_ = db.QueryRow("SELECT json_extract(params, '$.input_dir') FROM render_history WHERE uid = ?", uid).Scan(&dir)
+	if !dir.Valid || dir.String == "" || inputDirInUse(db, dir.String) {
+		return
+	}
+	if err := os.RemoveAll(dir.String); err != nil {
+		log.Printf("Inputs: не удалось удалить %s: %v", dir.String, err)
+		return
+	}
+	log.Printf("Inputs: файлы задачи %s удалены", uid)
+}
+
+// startInputJanitor раз в час удаляет папки задач, которые уже не понадобятся
+func startInputJanitor() {
+	go func() {
+		for {
+			cleanupInputDirs()
+			time.Sleep(inputJanitorInterval)
+		}
+	}()
+}
+
+func cleanupInputDirs() {
+	entries, err := os.ReadDir(cfg.InputDir)
+	if err != nil {
+		return
+	}
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		log.Println("Inputs: DB error:", err)
+		return
+	}
+	defer db.Close()
+
+	retention := cfg.inputRetention()
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue // файлы старых задач из общей папки не трогаем
+		}
+		dir := filepath.Join(cfg.InputDir, e.Name())
+		if inputDirInUse(db, dir) {
+			continue
+		}
+		var total, restartable int
+		err := db.QueryRow(`SELECT COUNT(*),
+			COALESCE(SUM(status IN ('error', 'canceled') AND submitted_at > datetime('now', ?)), 0)
+			FROM render_history WHERE json_extract(params, '$.input_dir') = ?`,
+			fmt.Sprintf("-%d seconds", int(retention.Seconds())), dir).Scan(&total, &restartable)
+		if err != nil || restartable > 0 {
+			continue
+		}
+		if total == 0 {
+			info, err := e.Info()
+			if err != nil || time.Since(info.ModTime()) < inputOrphanAge {
+				continue // задачу, возможно, ещё отправляют
+			}
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("Inputs: не удалось удалить %s: %v", dir, err)
+			continue
+		}
+		log.Printf("Inputs: удалена папка %s", dir)
+	}
+}
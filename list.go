@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Списки (шаблоны 9.x) и официальные перечни (10.x): поручения, законы
+
+// Настройки списков (options в схеме шаблона). Сколько пунктов — задаёт группа items.
+type listOptions struct {
+	LineChars int `json:"lineChars"` // сколько символов влезает в строку пункта
+	MaxLines  int `json:"maxLines"`  // сколько строк отведено под пункт
+}
+
+// Перенос строки в текстовом слое After Effects
+const aeLineBreak = "\r"
+
+// wrapText разбивает текст на строки не длиннее width символов по пробелам.
+// Слово длиннее строки режется по символам.
+func wrapText(s string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		for len([]rune(word)) > width {
+			if line != "" {
+				lines = append(lines, line)
+				line = ""
+			}
+			r := []rune(word)
+			lines = append(lines, string(r[:width]))
+			word = string(r[width:])
+		}
+		switch {
+		case line == "":
+			line = word
+		case len([]rune(line))+1+len([]rune(word)) <= width:
+			line += " " + word
+		default:
+			lines = append(lines, line)
+			line = word
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// buildListParams проверяет число пунктов и расставляет переносы строк по бюджету шаблона.
+//
+// params: {"items": [{"text": "..."}, ...]}, иконки — файлы list_icon_%d (см. схему шаблона).
+// Пункт, который не влезает в maxLines строк, не обрезается — возвращается ошибка.
+// В каждый пункт добавляется lines (число строк), в params — itemCount.
+func buildListParams(schema *TemplateSchema, params map[string]interface{}) error {
+	opts := listOptions{LineChars: 40, MaxLines: 2}
+	if err := schema.decodeOptions(&opts); err != nil {
+		return err
+	}
+	if opts.LineChars <= 0 || opts.MaxLines <= 0 {
+		return fmt.Errorf("Ошибка в настройках шаблона: lineChars и maxLines должны быть больше 0")
+	}
+	g, err := schema.group("items")
+	if err != nil {
+		return err
+	}
+
+	items := groupItems(params, "items")
+	if len(items) < g.Min || len(items) > g.Max {
+		return invalidf("В шаблоне должно быть от %d до %d пунктов, передано %d", g.Min, g.Max, len(items))
+	}
+	for i, item := range items {
+		// Переносы, расставленные при прошлом запуске, не мешают: strings.Fields их съедает
+		text := strings.TrimSpace(toString(item["text"]))
+		if text == "" {
+			return invalidf("Пункт %d: пустой текст", i+1)
+		}
+		lines := wrapText(text, opts.LineChars)
+		if len(lines) > opts.MaxLines {
+			return invalidf("Пункт %d не помещается: в шаблоне %d стр. по %d символов, нужно %d стр.",
+				i+1, opts.MaxLines, opts.LineChars, len(lines))
+		}
+		item["text"] = strings.Join(lines, aeLineBreak)
+		item["lines"] = len(lines)
+	}
+	params["itemCount"] = len(items)
+	return nil
+}
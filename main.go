@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bytes"
 	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
@@ -18,7 +17,6 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
-	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -33,20 +31,6 @@ type Template struct {
 	Description string `json:"description"`
 }
 
-type ThesisData struct {
-	Theses   []map[string]string `json:"theses"`
-	Template string              `json:"template"`
-	Image    string              `json:"image,omitempty"`
-	Audio    string              `json:"audio,omitempty"`
-}
-
-var lastSavedThesis ThesisData
-
-var (
-	sessions      = make(map[string]string) // sessionID -> username
-	sessionsMutex sync.Mutex
-)
-
 // Универсальная функция для возврата ошибок в JSON
 func writeJsonError(w http.ResponseWriter, msg string, code int) {
 	w.Header().Set("Content-Type", "application/json")
@@ -55,7 +39,7 @@ func writeJsonError(w http.ResponseWriter, msg string, code int) {
 }
 
 func checkUser(username, password string) (role string, ok bool) {
-	db, err := sql.Open("sqlite3", "./templates.db")
+	db, err := sql.Open("sqlite3", cfg.DBPath)
 	if err != nil {
 		return "", false
 	}
@@ -97,17 +81,36 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		writeJsonError(w, "Неверный логин или пароль", http.StatusUnauthorized)
 		return
 	}
-	sessionID := generateSessionID()
-	sessionsMutex.Lock()
-	sessions[sessionID] = creds.Username
-	sessionsMutex.Unlock()
+	// О блокировке сообщаем только после верного пароля
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		writeJsonError(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	block, err := userBlock(db, creds.Username)
+	db.Close()
+	if err != nil {
+		writeJsonError(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if block != nil {
+		writeBlockedError(w, block)
+		return
+	}
+	sessionID, err := createSession(creds.Username, r)
+	if err != nil {
+		log.Println("Ошибка создания сессии:", err)
+		writeJsonError(w, "DB error", http.StatusInternalServerError)
+		return
+	}
 
+	// Cookie живёт столько же, сколько сессия может продлеваться; срок самой сессии — на сервере
 	http.SetCookie(w, &http.Cookie{
 		Name:     "user_session",
 		Value:    sessionID,
 		Path:     "/",
 		HttpOnly: true,
-		MaxAge:   86400, // сутки
+		MaxAge:   int(sessionMaxAge.Seconds()),
 	})
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
@@ -119,9 +122,7 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 func logoutHandler(w http.ResponseWriter, r *http.Request) {
 	cookie, err := r.Cookie("user_session")
 	if err == nil {
-		sessionsMutex.Lock()
-		delete(sessions, cookie.Value)
-		sessionsMutex.Unlock()
+		deleteSession(cookie.Value)
 	}
 	http.SetCookie(w, &http.Cookie{
 		Name:    "user_session",
@@ -134,63 +135,17 @@ func logoutHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func whoamiHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("user_session")
-	if err != nil {
-		writeJsonError(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-	sessionsMutex.Lock()
-	username, ok := sessions[cookie.Value]
-	sessionsMutex.Unlock()
-	if !ok {
-		writeJsonError(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-	db, err := sql.Open("sqlite3", "./templates.db")
-	if err != nil {
-		writeJsonError(w, "DB error", http.StatusInternalServerError)
-		return
-	}
-	defer db.Close()
-	var role string
-	err = db.QueryRow("SELECT role FROM users WHERE username = ?", username).Scan(&role)
-	if err != nil {
-		writeJsonError(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	user := currentUser(r)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"username": username,
-		"role":     role,
+		"username": user.Username,
+		"role":     user.Role,
 	})
 }
 
 // --- СЕРВЕРНАЯ ЗАЩИТА admin.html --- //
+// Не-админа на главную отправляет requireAccess (маршрут page, см. auth.go)
 func adminPageHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("user_session")
-	if err != nil {
-		http.Redirect(w, r, "/", http.StatusFound)
-		return
-	}
-	sessionsMutex.Lock()
-	username, ok := sessions[cookie.Value]
-	sessionsMutex.Unlock()
-	if !ok {
-		http.Redirect(w, r, "/", http.StatusFound)
-		return
-	}
-	db, err := sql.Open("sqlite3", "./templates.db")
-	if err != nil {
-		http.Redirect(w, r, "/", http.StatusFound)
-		return
-	}
-	defer db.Close()
-	var role string
-	err = db.QueryRow("SELECT role FROM users WHERE username = ?", username).Scan(&role)
-	if err != nil || role != "admin" {
-		http.Redirect(w, r, "/", http.StatusFound)
-		return
-	}
 	http.ServeFile(w, r, "./protected/admin.html") // <--- путь к защищённому admin.html
 }
 
@@ -250,25 +205,14 @@ func saveTaskHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// --- Получаем username из сессии ---
-	cookie, err := r.Cookie("user_session")
-	if err != nil {
-		writeJsonError(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-	sessionsMutex.Lock()
-	username, ok := sessions[cookie.Value]
-	sessionsMutex.Unlock()
-	if !ok {
-		writeJsonError(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	username := currentUser(r).Username
 
 	taskType := r.FormValue("type")
 	templateID := r.FormValue("template") // <- Ожидается ЧИСЛО (id шаблона)
 
 	// --- Если вдруг приходит не id, а имя шаблона ---
 	if _, err := strconv.Atoi(templateID); err != nil {
-		db, _ := sql.Open("sqlite3", "./templates.db")
+		db, _ := sql.Open("sqlite3", cfg.DBPath)
 		defer db.Close()
 		var id int
 		_ = db.QueryRow("SELECT id FROM templates WHERE name = ?", templateID).Scan(&id)
@@ -282,149 +226,129 @@ func saveTaskHandler(w http.ResponseWriter, r *http.Request) {
 		log.Println("Ошибка JSON:", err)
 		return
 	}
+	if params == nil { // params=null
+		params = make(map[string]interface{})
+	}
+
+	schema, err := loadTemplateSchema(templateID)
+	if err != nil {
+		writeJsonError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if taskType == "" {
+		taskType = schema.Type
+	}
+	dropServerParams(taskType, params)
 
-	// --- Файлы (только для тезисов, если нужно) ---
-	if taskType == "thesis" {
-		audioPath := filepath.Join("C:/Users/Yarik/Downloads/DIPLOMA/input", "audio.mp3")
-		if audioFile, _, err := r.FormFile("audio"); err == nil {
-			defer audioFile.Close()
-			saveFile(audioFile, audioPath)
-			params["audioPath"] = audioPath
+	// --- Файлы, описанные в схеме шаблона (картинки, аудио), — в свою папку задачи ---
+	taskID := fmt.Sprintf("%s_%d", templateID, time.Now().UnixNano())
+	inputDir, err := newInputDir(taskID)
+	if err != nil {
+		writeJsonError(w, "Ошибка сохранения файла", http.StatusInternalServerError)
+		log.Println("Ошибка создания папки задачи:", err)
+		return
+	}
+	submitted := false
+	defer func() {
+		if !submitted {
+			os.RemoveAll(inputDir)
 		}
-		if thesesRaw, ok := params["theses"].([]interface{}); ok {
-			for i := 1; i <= len(thesesRaw); i++ {
-				fieldName := fmt.Sprintf("thesis_img_%d", i)
-				file, _, err := r.FormFile(fieldName)
-				imgPath := ""
-				if err == nil {
-					defer file.Close()
-					imgPath = filepath.Join("C:/Users/Yarik/Downloads/DIPLOMA/input", fmt.Sprintf("image_%d.png", i))
-					saveFile(file, imgPath)
-				}
-				params[fmt.Sprintf("imagePath_%d", i)] = imgPath
-			}
+	}()
+	params["input_dir"] = inputDir
+	if err := saveSchemaUploads(r, schema, params, inputDir, ""); err != nil {
+		if errorStatus(err) == http.StatusBadRequest {
+			writeJsonError(w, err.Error(), http.StatusBadRequest)
+			return
 		}
+		writeJsonError(w, "Ошибка сохранения файла", http.StatusInternalServerError)
+		log.Println("Ошибка сохранения файла:", err)
+		return
 	}
 
 	// --- Формируем уникальный outputPath ---
-	base := "C:/Users/Yarik/Downloads/DIPLOMA"
-	outputPath := filepath.Join(base, "output", fmt.Sprintf("%s_%d.mp4", templateID, time.Now().UnixNano()))
+	outputPath := filepath.Join(cfg.OutputDir, taskID+".mp4")
 	params["output_path"] = outputPath
 
 	// --- Собираем Nexrender job ---
 	job, err := buildJob(taskType, templateID, outputPath, params, username)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Ошибка сборки job: " + err.Error()})
+		writeJsonError(w, "Ошибка сборки job: "+err.Error(), errorStatus(err))
 		return
 	}
 
-	log.Printf("ASSETS in job: %+v", job["assets"])
+	log.Printf("ASSETS in job: %+v", job.Assets)
 	nexrenderUid, err := createNexrenderJob(job)
 	if err != nil {
 		writeJsonError(w, "Ошибка отправки задачи в nexrender-server: "+err.Error(), 500)
 		log.Println("Ошибка отправки задачи в nexrender-server:", err)
 		return
 	}
+	submitted = true
 
 	// --- Сохраняем историю с правильным template_id ---
 	saveRenderHistory(username, nexrenderUid, taskType, templateID, params, "queued")
 	log.Println("Задача отправлена в nexrender-server, UID:", nexrenderUid)
+	resp := map[string]interface{}{"status": "render_started", "uid": nexrenderUid}
+	if warnings, ok := params["warnings"]; ok {
+		resp["warnings"] = warnings
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "render_started", "uid": nexrenderUid})
+	json.NewEncoder(w).Encode(resp)
 }
 
-func buildJob(taskType, template, outputPath string, params map[string]interface{}, username string) (map[string]interface{}, error) {
-	base := "C:/Users/Yarik/Downloads/DIPLOMA"
+func buildJob(taskType, template, outputPath string, params map[string]interface{}, username string) (*NexrenderJob, error) {
 	aepPath, err := getAepPathById(template)
 	if err != nil || aepPath == "" {
 		return nil, fmt.Errorf("Не найден путь к .aep")
 	}
-	aepFile := filepath.Join(base, "templates", aepPath)
-
-	var assets []map[string]interface{}
-	var composition string
+	aepFile := filepath.Join(cfg.TemplatesDir, aepPath)
 
-	switch taskType {
-	case "thesis":
-		composition = getCompositionName(template)
-		audioPath, _ := params["audioPath"].(string)
-		assets = append(assets, map[string]interface{}{
-			"composition": "IZ_TEZIS",
-			"layerName":   "audio",
-			"src":         "file:///" + filepath.ToSlash(audioPath),
-			"type":        "audio",
-		})
-
-		theses, _ := params["theses"].([]interface{})
-		for i, tRaw := range theses {
-			t, _ := tRaw.(map[string]interface{})
-			compPath := fmt.Sprintf("IZ_TEZIS->Text->Tezis_%d", i+1)
-			assets = append(assets,
-				map[string]interface{}{
-					"composition": compPath,
-					"layerName":   "text",
-					"type":        "data",
-					"property":    "Source Text",
-					"value":       t["text"],
-				},
-				map[string]interface{}{
-					"composition": compPath,
-					"layerName":   "regalia",
-					"type":        "data",
-					"property":    "Source Text",
-					"value":       t["title"],
-				})
-			if img, ok := params[fmt.Sprintf("imagePath_%d", i+1)].(string); ok && img != "" {
-				assets = append(assets, map[string]interface{}{
-					"composition": fmt.Sprintf("IZ_TEZIS->Tezis_Image_%d->IMAGE_%d", i+1, i+1),
-					"layerName":   "photo",
-					"src":         "file:///" + filepath.ToSlash(img),
-					"type":        "image",
-				})
-			}
+	schema, err := loadTemplateSchema(template)
+	if err != nil {
+		return nil, err
+	}
+	if schema.Type != "" && taskType != schema.Type {
+		return nil, invalidf("Шаблон %s не поддерживает тип задачи %q", template, taskType)
+	}
+	if err := checkTaskFiles(schema, params); err != nil {
+		return nil, err
+	}
+	if prepare, ok := taskBuilders[taskType]; ok {
+		delete(params, "warnings") // при перезапуске предупреждения собираются заново
+		if err := prepare(schema, params); err != nil {
+			return nil, err
 		}
-	case "quote":
-		composition = "QUOTE_MAIN"
-		quoteText := params["quote"].(string)
-		author := params["author"].(string)
-		assets = append(assets,
-			map[string]interface{}{
-				"composition": composition,
-				"layerName":   "text",
-				"type":        "data",
-				"property":    "Source Text",
-				"value":       quoteText,
-			},
-			map[string]interface{}{
-				"composition": composition,
-				"layerName":   "author",
-				"type":        "data",
-				"property":    "Source Text",
-				"value":       author,
-			})
-	default:
-		return nil, fmt.Errorf("Неизвестный тип задачи")
-	}
-
-	job := map[string]interface{}{
-		"template": map[string]string{
-			"src":         "file:///" + filepath.ToSlash(aepFile),
-			"composition": composition,
-			"output":      outputPath,
+	}
+	assets, err := buildSchemaAssets(schema, params)
+	if err != nil {
+		return nil, err
+	}
+	if schema.Composition == "" {
+		return nil, fmt.Errorf("В схеме шаблона %s не указана композиция", template)
+	}
+
+	job := &NexrenderJob{
+		Template: NexrenderTemplate{
+			Src:         "file:///" + filepath.ToSlash(aepFile),
+			Composition: schema.Composition,
+			Output:      outputPath,
 		},
-		"assets":  assets,
-		"actions": map[string]interface{}{"postrender": []interface{}{}},
-		"data": map[string]interface{}{
+		Assets:  assets,
+		Actions: NexrenderActions{Postrender: []NexrenderAction{}},
+		Data: map[string]interface{}{
 			"user": username,
 		},
 	}
+	if dir := toString(params["input_dir"]); dir != "" {
+		job.Data["inputDir"] = dir
+	}
+	addSequenceJoinAction(job, params)
+	addWebhookActions(job)
 	return job, nil
 }
 
 func saveRenderHistory(username, uid, taskType, templateID string, params map[string]interface{}, status string) {
-	db, err := sql.Open("sqlite3", "./templates.db")
+	db, err := sql.Open("sqlite3", cfg.DBPath)
 	if err != nil {
 		log.Println("DB error:", err)
 		return
@@ -435,11 +359,13 @@ func saveRenderHistory(username, uid, taskType, templateID string, params map[st
 		username, uid, taskType, templateID, string(paramsJSON), status)
 	if err != nil {
 		log.Println("Ошибка записи истории рендера:", err)
+		return
 	}
+	notifyRender(db, uid)
 }
 
 func getAepPathById(templateId string) (string, error) {
-	db, err := sql.Open("sqlite3", "./templates.db")
+	db, err := sql.Open("sqlite3", cfg.DBPath)
 	if err != nil {
 		return "", err
 	}
@@ -452,80 +378,23 @@ func getAepPathById(templateId string) (string, error) {
 	return aepPath, nil
 }
 
-func getCompositionName(template string) string {
-	mapping := map[string]string{
-		"66":      "IZ_TEZIS",
-		"quote_1": "QUOTE_MAIN",
-	}
-	if name, ok := mapping[template]; ok {
-		return name
-	}
-	return "Main"
-}
-
-func getNexrenderJobStatus(uid string) (map[string]interface{}, error) {
-	resp, err := http.Get("http://localhost:3000/api/v1/jobs/" + uid)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	if len(body) == 0 {
-		return nil, fmt.Errorf("empty response from nexrender")
-	}
-
-	var data map[string]interface{}
-	if err := json.Unmarshal(body, &data); err != nil {
-		return nil, err
-	}
-	return data, nil
+func getNexrenderJobStatus(uid string) (*NexrenderJob, error) {
+	return renderer.Status(uid)
 }
 
-func createNexrenderJob(job interface{}) (string, error) {
-	data, err := json.Marshal(job)
-	if err != nil {
-		return "", err
-	}
-	resp, err := http.Post("http://localhost:3000/api/v1/jobs", "application/json", bytes.NewBuffer(data))
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != 201 && resp.StatusCode != 200 {
-		return "", fmt.Errorf("Ошибка отправки job: %s", string(body))
-	}
-	var respData map[string]interface{}
-	if err := json.Unmarshal(body, &respData); err != nil {
-		return "", err
-	}
-
-	fmt.Println("Ответ nexrender:", string(body))
-	uid, ok := respData["uid"].(string)
-	if !ok || uid == "" {
-		// Для надёжности, попытаемся как число
-		uidAny := respData["uid"]
-		if uidAny != nil {
-			uid = fmt.Sprintf("%v", uidAny)
-			if uid != "" {
-				return uid, nil
-			}
-		}
-		return "", fmt.Errorf("Ошибка: не удалось получить uid из ответа: %s", string(body))
-	}
-	return uid, nil
-
+func createNexrenderJob(job *NexrenderJob) (string, error) {
+	return renderer.Submit(job)
 }
 
 func getTemplatesHandler(w http.ResponseWriter, r *http.Request) {
-	db, err := sql.Open("sqlite3", "./templates.db")
+	db, err := sql.Open("sqlite3", cfg.DBPath)
 	if err != nil {
 		writeJsonError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	defer db.Close()
 
-	rows, err := db.Query("SELECT id, name, category, preview_path, description FROM templates")
+	rows, err := db.Query("SELECT id, name, category, preview_path, description FROM templates WHERE " + catalogTemplatesCond)
 	if err != nil {
 		writeJsonError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -561,50 +430,32 @@ func renderStatusHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(status)
 }
 
-// Получение истории рендеров для текущего пользователя (или всей истории для админа)
 // Получение истории рендеров для текущего пользователя (или всей истории для админа)
 func renderHistoryHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("user_session")
-	if err != nil {
-		writeJsonError(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-	sessionsMutex.Lock()
-	username, ok := sessions[cookie.Value]
-	sessionsMutex.Unlock()
-	if !ok {
-		writeJsonError(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
+	user := currentUser(r)
+	username := user.Username
 
-	db, err := sql.Open("sqlite3", "./templates.db")
+	db, err := sql.Open("sqlite3", cfg.DBPath)
 	if err != nil {
 		writeJsonError(w, "DB error", http.StatusInternalServerError)
 		return
 	}
 	defer db.Close()
 
-	// Получаем роль пользователя
-	var role string
-	err = db.QueryRow("SELECT role FROM users WHERE username = ?", username).Scan(&role)
-	if err != nil {
-		writeJsonError(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	var rows *sql.Rows
-	if role == "admin" {
+	if user.IsAdmin() {
 		rows, err = db.Query(`
-			SELECT rh.id, t.name, rh.username, rh.uid, rh.type, rh.params, rh.submitted_at, rh.status
+			SELECT rh.id, COALESCE(t.name, 'Сюжет'), rh.username, rh.uid, rh.type, rh.params, rh.submitted_at, rh.status
 			FROM render_history rh
 			LEFT JOIN templates t ON rh.template_id = t.id
+			WHERE rh.parent_id IS NULL
 			ORDER BY rh.id DESC LIMIT 100`)
 	} else {
 		rows, err = db.Query(`
-			SELECT rh.id, t.name, rh.username, rh.uid, rh.type, rh.params, rh.submitted_at, rh.status
+			SELECT rh.id, COALESCE(t.name, 'Сюжет'), rh.username, rh.uid, rh.type, rh.params, rh.submitted_at, rh.status
 			FROM render_history rh
 			LEFT JOIN templates t ON rh.template_id = t.id
-			WHERE rh.username = ?
+			WHERE rh.username = ? AND rh.parent_id IS NULL
 			ORDER BY rh.id DESC LIMIT 100`, username)
 	}
 	if err != nil {
@@ -644,7 +495,7 @@ func renderHistoryHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func updateRenderHistoryStatus(uid, newStatus, outputPath string) error {
-	db, err := sql.Open("sqlite3", "./templates.db")
+	db, err := sql.Open("sqlite3", cfg.DBPath)
 	if err != nil {
 		return err
 	}
@@ -658,199 +509,23 @@ func updateRenderHistoryStatus(uid, newStatus, outputPath string) error {
 	} else {
 		_, err = db.Exec("UPDATE render_history SET status = ? WHERE uid = ?", newStatus, uid)
 	}
+	if err == nil {
+		notifyRender(db, uid)
+	}
 	return err
 }
 
-func startStatusUpdater() {
-	go func() {
-		for {
-			time.Sleep(2 * time.Second) // Теперь чаще опрашиваем
-
-			db, err := sql.Open("sqlite3", "./templates.db")
-			if err != nil {
-				log.Println("StatusUpdater: DB error:", err)
-				continue
-			}
-
-			rows, err := db.Query("SELECT uid, status FROM render_history WHERE status IN ('queued', 'rendering')")
-			if err != nil {
-				db.Close()
-				continue
-			}
-
-			var uids []string
-			for rows.Next() {
-				var uid, status string
-				if err := rows.Scan(&uid, &status); err == nil {
-					uids = append(uids, uid)
-				}
-			}
-			rows.Close()
-			db.Close()
-
-			for _, uid := range uids {
-				statusObj, err := getNexrenderJobStatus(uid)
-				log.Printf("[DEBUG] Ответ от Nexrender для %s: %+v, err: %v", uid, statusObj, err)
-				var myStatus string
-				var outputPath string
-				var progress float64
-
-				// Получаем старый прогресс из БД
-				dbp, _ := sql.Open("sqlite3", "./templates.db")
-				var paramsStr string
-				_ = dbp.QueryRow("SELECT params FROM render_history WHERE uid = ?", uid).Scan(&paramsStr)
-				var params map[string]interface{}
-				_ = json.Unmarshal([]byte(paramsStr), &params)
-				dbp.Close()
-
-				if err != nil || statusObj == nil {
-					// Проверяем, сколько времени прошло с момента создания задачи
-					dbCheck, _ := sql.Open("sqlite3", "./templates.db")
-					var submittedAt string
-					_ = dbCheck.QueryRow("SELECT submitted_at FROM render_history WHERE uid = ?", uid).Scan(&submittedAt)
-					dbCheck.Close()
-
-					t, errParse := time.Parse(time.RFC3339, submittedAt)
-					if errParse != nil {
-						t, errParse = time.Parse("2006-01-02 15:04:05", submittedAt)
-						if errParse != nil {
-							t, _ = time.Parse("2006-01-02 15:04", submittedAt)
-						}
-					}
-					if !t.IsZero() && time.Since(t) < 90*time.Second {
-						log.Printf("StatusUpdater: %s нет в nexrender, задача свежая (%s), ждём...\n", uid, submittedAt)
-						continue
-					}
-
-					// Проверяем, вдруг output-файл уже готов
-					dbFile, _ := sql.Open("sqlite3", "./templates.db")
-					var paramsStr string
-					_ = dbFile.QueryRow("SELECT params FROM render_history WHERE uid = ?", uid).Scan(&paramsStr)
-					dbFile.Close()
-					var params map[string]interface{}
-					_ = json.Unmarshal([]byte(paramsStr), &params)
-					opath, _ := params["output_path"].(string)
-					fi, errStat := os.Stat(opath)
-					if errStat == nil && fi.Size() > 1024*1024 {
-						myStatus = "done"
-						outputPath = opath
-						log.Printf("StatusUpdater: file найден для %s, ставим done\n", uid)
-						progress = 1.0
-					} else {
-						myStatus = "error"
-						outputPath = opath
-						log.Printf("StatusUpdater: nexrender error/empty для %s, ставим error\n", uid)
-						progress = 0.0
-					}
-				} else {
-					status, _ := statusObj["state"].(string)
-					// --- Вот тут меняем: всегда используем renderProgress!
-					// 1. Вытаскиваем renderProgress
-					// Универсальное вытаскивание renderProgress независимо от типа
-					progress = 0
-					if prRaw, ok := statusObj["renderProgress"]; ok {
-						switch v := prRaw.(type) {
-						case float64:
-							if v > 1.01 {
-								progress = v / 100.0
-							} else {
-								progress = v
-							}
-						case int:
-							if v > 1 {
-								progress = float64(v) / 100.0
-							} else {
-								progress = float64(v)
-							}
-						case json.Number:
-							prFloat, err := v.Float64()
-							if err == nil {
-								if prFloat > 1.01 {
-									progress = prFloat / 100.0
-								} else {
-									progress = prFloat
-								}
-							}
-						default:
-							// Ну мало ли...
-							progress = 0
-						}
-					}
-
-					// 2. Определяем статус из state (statusObj["state"])
-					switch status {
-					case "finished":
-						myStatus = "done"
-						progress = 1.0
-					case "queued", "created":
-						myStatus = "queued"
-					case "errored", "failed", "canceled":
-						myStatus = "error"
-					case "picked", "started":
-						myStatus = "rendering"
-					default:
-						// если статус начинается с "render:" — значит рендерится
-						if len(status) > 7 && status[:7] == "render:" {
-							myStatus = "rendering"
-						} else {
-							myStatus = "unknown"
-						}
-					}
-
-					// 3. Прогресс: только от renderProgress, НЕ делай done, если он == 1!
-					// (оставь так же, как ты уже вытаскиваешь)
-
-					if out, ok := statusObj["output"].(string); ok && out != "" {
-						outputPath = out
-					}
-				}
-				// Обновляем params
-				params["progress"] = progress
-				paramsJSON, _ := json.Marshal(params)
-
-				// Сохраняем статус и прогресс
-				dbp2, _ := sql.Open("sqlite3", "./templates.db")
-				_, _ = dbp2.Exec(`UPDATE render_history SET status = ?, params = ? WHERE uid = ?`, myStatus, string(paramsJSON), uid)
-				dbp2.Close()
-
-				log.Printf("[PROGRESS] %s | status: %s | progress: %.2f", uid, myStatus, progress)
-				updateRenderHistoryStatus(uid, myStatus, outputPath)
-			}
-		}
-	}()
-}
-
 // Только для админа!
 func adminStatsHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("user_session")
-	if err != nil {
-		writeJsonError(w, "Unauthorized", 401)
-		return
-	}
-	sessionsMutex.Lock()
-	username, ok := sessions[cookie.Value]
-	sessionsMutex.Unlock()
-	if !ok {
-		writeJsonError(w, "Unauthorized", 401)
-		return
-	}
-
-	db, err := sql.Open("sqlite3", "./templates.db")
+	db, err := sql.Open("sqlite3", cfg.DBPath)
 	if err != nil {
 		writeJsonError(w, "DB error", 500)
 		return
 	}
 	defer db.Close()
 
-	var role string
-	err = db.QueryRow("SELECT role FROM users WHERE username = ?", username).Scan(&role)
-	if err != nil || role != "admin" {
-		writeJsonError(w, "Forbidden", 403)
-		return
-	}
-
 	var totalTemplates, totalRenders int
-	db.QueryRow("SELECT COUNT(*) FROM templates").Scan(&totalTemplates)
+	db.QueryRow("SELECT COUNT(*) FROM templates WHERE " + catalogTemplatesCond).Scan(&totalTemplates)
 	db.QueryRow("SELECT COUNT(*) FROM render_history").Scan(&totalRenders)
 
 	w.Header().Set("Content-Type", "application/json")
@@ -861,37 +536,18 @@ func adminStatsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func adminRendersHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("user_session")
-	if err != nil {
-		writeJsonError(w, "Unauthorized", 401)
-		return
-	}
-	sessionsMutex.Lock()
-	username, ok := sessions[cookie.Value]
-	sessionsMutex.Unlock()
-	if !ok {
-		writeJsonError(w, "Unauthorized", 401)
-		return
-	}
-
-	db, err := sql.Open("sqlite3", "./templates.db")
+	db, err := sql.Open("sqlite3", cfg.DBPath)
 	if err != nil {
 		writeJsonError(w, "DB error", 500)
 		return
 	}
 	defer db.Close()
 
-	var role string
-	err = db.QueryRow("SELECT role FROM users WHERE username = ?", username).Scan(&role)
-	if err != nil || role != "admin" {
-		writeJsonError(w, "Forbidden", 403)
-		return
-	}
-
 	rows, err := db.Query(`
-		SELECT rh.id, t.name, rh.username, rh.submitted_at, rh.status, rh.uid, rh.params
+		SELECT rh.id, COALESCE(t.name, 'Сюжет'), rh.username, rh.submitted_at, rh.status, rh.uid, rh.params
 		FROM render_history rh
 		LEFT JOIN templates t ON rh.template_id = t.id
+		WHERE rh.parent_id IS NULL
 		ORDER BY rh.id DESC LIMIT 100`)
 	if err != nil {
 		writeJsonError(w, "DB error", 500)
@@ -940,33 +596,13 @@ func adminDeleteRenderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cookie, err := r.Cookie("user_session")
-	if err != nil {
-		writeJsonError(w, "Unauthorized", 401)
-		return
-	}
-	sessionsMutex.Lock()
-	username, ok := sessions[cookie.Value]
-	sessionsMutex.Unlock()
-	if !ok {
-		writeJsonError(w, "Unauthorized", 401)
-		return
-	}
-
-	db, err := sql.Open("sqlite3", "./templates.db")
+	db, err := sql.Open("sqlite3", cfg.DBPath)
 	if err != nil {
 		writeJsonError(w, "DB error", 500)
 		return
 	}
 	defer db.Close()
 
-	var role string
-	err = db.QueryRow("SELECT role FROM users WHERE username = ?", username).Scan(&role)
-	if err != nil || role != "admin" {
-		writeJsonError(w, "Forbidden", 403)
-		return
-	}
-
 	var req struct {
 		UID string `json:"uid"`
 	}
@@ -979,12 +615,22 @@ func adminDeleteRenderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Задачу в работе сначала останавливаем в Nexrender, иначе она дорендерится
+	var status string
+	if err := db.QueryRow("SELECT status FROM render_history WHERE uid = ?", req.UID).Scan(&status); err == nil &&
+		(status == "queued" || status == "rendering") {
+		if err := cancelRender(db, req.UID); err != nil {
+			log.Printf("Ошибка отмены задачи %s: %v", req.UID, err)
+		}
+	}
+
 	// "Мягкое" удаление: меняем статус на "deleted"
 	_, err = db.Exec("UPDATE render_history SET status = 'deleted' WHERE uid = ?", req.UID)
 	if err != nil {
 		writeJsonError(w, "DB error", 500)
 		return
 	}
+	notifyRender(db, req.UID)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"result": "ok"})
@@ -996,33 +642,13 @@ func adminRestartRenderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cookie, err := r.Cookie("user_session")
-	if err != nil {
-		writeJsonError(w, "Unauthorized", 401)
-		return
-	}
-	sessionsMutex.Lock()
-	username, ok := sessions[cookie.Value]
-	sessionsMutex.Unlock()
-	if !ok {
-		writeJsonError(w, "Unauthorized", 401)
-		return
-	}
-
-	db, err := sql.Open("sqlite3", "./templates.db")
+	db, err := sql.Open("sqlite3", cfg.DBPath)
 	if err != nil {
 		writeJsonError(w, "DB error", 500)
 		return
 	}
 	defer db.Close()
 
-	var role string
-	err = db.QueryRow("SELECT role FROM users WHERE username = ?", username).Scan(&role)
-	if err != nil || role != "admin" {
-		writeJsonError(w, "Forbidden", 403)
-		return
-	}
-
 	var req struct {
 		UID string `json:"uid"`
 	}
@@ -1037,26 +663,46 @@ func adminRestartRenderHandler(w http.ResponseWriter, r *http.Request) {
 
 	// 1. Получаем старые параметры задачи
 	var templateID, taskType, paramsStr, origUsername string
-	err = db.QueryRow("SELECT template_id, type, params, username FROM render_history WHERE uid = ?", req.UID).
-		Scan(&templateID, &taskType, &paramsStr, &origUsername)
+	var parentID sql.NullInt64
+	err = db.QueryRow("SELECT template_id, type, params, username, parent_id FROM render_history WHERE uid = ?", req.UID).
+		Scan(&templateID, &taskType, &paramsStr, &origUsername, &parentID)
 	if err != nil {
 		writeJsonError(w, "Задача не найдена", 404)
 		return
 	}
+	if taskType == "sequence" {
+		writeJsonError(w, "Сюжет перезапускается по частям", 400)
+		return
+	}
 	var params map[string]interface{}
 	if err := json.Unmarshal([]byte(paramsStr), &params); err != nil {
 		writeJsonError(w, "Ошибка чтения параметров задачи", 500)
 		return
 	}
 
+	// Файлы задачи хранятся ограниченное время (см. inputs.go)
+	if dir := toString(params["input_dir"]); dir != "" {
+		if _, err := os.Stat(dir); err != nil {
+			writeJsonError(w, "Загруженные файлы задачи уже удалены, отправьте её заново", http.StatusConflict)
+			return
+		}
+	}
+
 	// 2. Генерируем новый outputPath
-	outputPath := fmt.Sprintf("C:/Users/Yarik/Downloads/DIPLOMA/output/%s_restart_%d.mp4", templateID, time.Now().UnixNano())
+	outputPath := filepath.Join(cfg.OutputDir, fmt.Sprintf("%s_restart_%d.mp4", templateID, time.Now().UnixNano()))
 	params["output_path"] = outputPath
 
 	// 3. Собираем новый Nexrender job
+	if taskType == "transition" && templateID == "" {
+		// Переходы старых сюжетов записаны без шаблона
+		if templateID, err = defaultTransitionTemplate(); err != nil {
+			writeJsonError(w, err.Error(), 500)
+			return
+		}
+	}
 	job, err := buildJob(taskType, templateID, outputPath, params, origUsername)
 	if err != nil {
-		writeJsonError(w, "Ошибка buildJob: "+err.Error(), 500)
+		writeJsonError(w, "Ошибка buildJob: "+err.Error(), errorStatus(err))
 		return
 	}
 
@@ -1072,6 +718,18 @@ func adminRestartRenderHandler(w http.ResponseWriter, r *http.Request) {
 
 	// 6. Старую задачу помечаем как "restarted" (или можешь ничего не делать)
 	_, _ = db.Exec("UPDATE render_history SET status = 'restarted' WHERE uid = ?", req.UID)
+	notifyRender(db, req.UID)
+
+	// 7. Перезапущенная часть сюжета остаётся в сюжете, а сам сюжет снова ждёт склейки
+	if parentID.Valid {
+		_, _ = db.Exec("UPDATE render_history SET parent_id = ? WHERE uid = ?", parentID.Int64, newUid)
+		_, _ = db.Exec("UPDATE render_history SET status = 'rendering' WHERE id = ? AND status = 'error'", parentID.Int64)
+		notifyRender(db, newUid)
+		var parentUID string
+		if err := db.QueryRow("SELECT uid FROM render_history WHERE id = ?", parentID.Int64).Scan(&parentUID); err == nil {
+			notifyRender(db, parentUID)
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
@@ -1085,31 +743,12 @@ func adminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
 		writeJsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	cookie, err := r.Cookie("user_session")
-	if err != nil {
-		writeJsonError(w, "Unauthorized", 401)
-		return
-	}
-	sessionsMutex.Lock()
-	username, ok := sessions[cookie.Value]
-	sessionsMutex.Unlock()
-	if !ok {
-		writeJsonError(w, "Unauthorized", 401)
-		return
-	}
-
-	db, err := sql.Open("sqlite3", "./templates.db")
+	db, err := sql.Open("sqlite3", cfg.DBPath)
 	if err != nil {
 		writeJsonError(w, "DB error", 500)
 		return
 	}
 	defer db.Close()
-	var role string
-	err = db.QueryRow("SELECT role FROM users WHERE username = ?", username).Scan(&role)
-	if err != nil || role != "admin" {
-		writeJsonError(w, "Forbidden", 403)
-		return
-	}
 
 	var req struct {
 		Username string `json:"username"`
@@ -1146,31 +785,13 @@ func adminCreateUserHandler(w http.ResponseWriter, r *http.Request) {
 
 // Получить список всех пользователей (ТОЛЬКО для админа)
 func adminUsersListHandler(w http.ResponseWriter, r *http.Request) {
-	cookie, err := r.Cookie("user_session")
-	if err != nil {
-		writeJsonError(w, "Unauthorized", 401)
-		return
-	}
-	sessionsMutex.Lock()
-	username, ok := sessions[cookie.Value]
-	sessionsMutex.Unlock()
-	if !ok {
-		writeJsonError(w, "Unauthorized", 401)
-		return
-	}
-	db, err := sql.Open("sqlite3", "./templates.db")
+	db, err := sql.Open("sqlite3", cfg.DBPath)
 	if err != nil {
 		writeJsonError(w, "DB error", 500)
 		return
 	}
 	defer db.Close()
-	var role string
-	err = db.QueryRow("SELECT role FROM users WHERE username = ?", username).Scan(&role)
-	if err != nil || role != "admin" {
-		writeJsonError(w, "Forbidden", 403)
-		return
-	}
-	rows, err := db.Query("SELECT id, username, role, status FROM users ORDER BY id")
+	rows, err := db.Query("SELECT id, username, role, status, COALESCE(block_reason, ''), COALESCE(block_until, '') FROM users ORDER BY id")
 	if err != nil {
 		writeJsonError(w, "DB error", 500)
 		return
@@ -1182,11 +803,16 @@ func adminUsersListHandler(w http.ResponseWriter, r *http.Request) {
 		Username string `json:"username"`
 		Role     string `json:"role"`
 		Status   string `json:"status"` // "active" / "blocked"
+		Reason   string `json:"block_reason,omitempty"`
+		Until    string `json:"block_until,omitempty"`
 	}
 	var users []U
 	for rows.Next() {
 		var u U
-		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.Status); err == nil {
+		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.Status, &u.Reason, &u.Until); err == nil {
+			if t, err := parseBlockTime(u.Until); err == nil {
+				u.Until = t.UTC().Format(time.RFC3339)
+			}
 			users = append(users, u)
 		}
 	}
@@ -1200,30 +826,12 @@ func adminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 		writeJsonError(w, "Method not allowed", 405)
 		return
 	}
-	cookie, err := r.Cookie("user_session")
-	if err != nil {
-		writeJsonError(w, "Unauthorized", 401)
-		return
-	}
-	sessionsMutex.Lock()
-	username, ok := sessions[cookie.Value]
-	sessionsMutex.Unlock()
-	if !ok {
-		writeJsonError(w, "Unauthorized", 401)
-		return
-	}
-	db, err := sql.Open("sqlite3", "./templates.db")
+	db, err := sql.Open("sqlite3", cfg.DBPath)
 	if err != nil {
 		writeJsonError(w, "DB error", 500)
 		return
 	}
 	defer db.Close()
-	var role string
-	err = db.QueryRow("SELECT role FROM users WHERE username = ?", username).Scan(&role)
-	if err != nil || role != "admin" {
-		writeJsonError(w, "Forbidden", 403)
-		return
-	}
 	var req struct {
 		Username string `json:"username"`
 	}
@@ -1236,6 +844,9 @@ func adminDeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 		writeJsonError(w, "DB error", 500)
 		return
 	}
+	if _, err := revokeUserSessions(db, req.Username); err != nil {
+		log.Println("Ошибка завершения сессий:", err)
+	}
 	w.Write([]byte(`{"result":"ok"}`))
 }
 
@@ -1245,42 +856,32 @@ func adminBlockUserHandler(w http.ResponseWriter, r *http.Request) {
 		writeJsonError(w, "Method not allowed", 405)
 		return
 	}
-	cookie, err := r.Cookie("user_session")
-	if err != nil {
-		writeJsonError(w, "Unauthorized", 401)
-		return
-	}
-	sessionsMutex.Lock()
-	username, ok := sessions[cookie.Value]
-	sessionsMutex.Unlock()
-	if !ok {
-		writeJsonError(w, "Unauthorized", 401)
-		return
-	}
-	db, err := sql.Open("sqlite3", "./templates.db")
+	db, err := sql.Open("sqlite3", cfg.DBPath)
 	if err != nil {
 		writeJsonError(w, "DB error", 500)
 		return
 	}
 	defer db.Close()
-	var role string
-	err = db.QueryRow("SELECT role FROM users WHERE username = ?", username).Scan(&role)
-	if err != nil || role != "admin" {
-		writeJsonError(w, "Forbidden", 403)
-		return
-	}
-	var req struct {
-		Username string `json:"username"`
-	}
+	// {"username": "...", "reason": "...", "until": "2026-11-01T00:00:00+03:00"}, reason и until — необязательные
+	var req blockRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" {
 		writeJsonError(w, "Bad request", 400)
 		return
 	}
-	_, err = db.Exec("UPDATE users SET status = 'blocked' WHERE username = ?", req.Username)
+	until, err := req.blockUntil()
+	if err != nil {
+		writeJsonError(w, err.Error(), 400)
+		return
+	}
+	_, err = db.Exec("UPDATE users SET status = 'blocked', block_reason = ?, block_until = ? WHERE username = ?",
+		req.reason(), until, req.Username)
 	if err != nil {
 		writeJsonError(w, "DB error", 500)
 		return
 	}
+	if _, err := revokeUserSessions(db, req.Username); err != nil {
+		log.Println("Ошибка завершения сессий:", err)
+	}
 	w.Write([]byte(`{"result":"ok"}`))
 }
 
@@ -1290,30 +891,12 @@ func adminUnblockUserHandler(w http.ResponseWriter, r *http.Request) {
 		writeJsonError(w, "Method not allowed", 405)
 		return
 	}
-	cookie, err := r.Cookie("user_session")
-	if err != nil {
-		writeJsonError(w, "Unauthorized", 401)
-		return
-	}
-	sessionsMutex.Lock()
-	username, ok := sessions[cookie.Value]
-	sessionsMutex.Unlock()
-	if !ok {
-		writeJsonError(w, "Unauthorized", 401)
-		return
-	}
-	db, err := sql.Open("sqlite3", "./templates.db")
+	db, err := sql.Open("sqlite3", cfg.DBPath)
 	if err != nil {
 		writeJsonError(w, "DB error", 500)
 		return
 	}
 	defer db.Close()
-	var role string
-	err = db.QueryRow("SELECT role FROM users WHERE username = ?", username).Scan(&role)
-	if err != nil || role != "admin" {
-		writeJsonError(w, "Forbidden", 403)
-		return
-	}
 	var req struct {
 		Username string `json:"username"`
 	}
@@ -1321,7 +904,7 @@ func adminUnblockUserHandler(w http.ResponseWriter, r *http.Request) {
 		writeJsonError(w, "Bad request", 400)
 		return
 	}
-	_, err = db.Exec("UPDATE users SET status = 'active' WHERE username = ?", req.Username)
+	_, err = db.Exec("UPDATE users SET status = 'active', block_reason = NULL, block_until = NULL WHERE username = ?", req.Username)
 	if err != nil {
 		writeJsonError(w, "DB error", 500)
 		return
@@ -1330,45 +913,37 @@ func adminUnblockUserHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
-	_ = mime.AddExtensionType(".js", "application/javascript")
-
-	fs := http.FileServer(http.Dir("./static"))
-	http.Handle("/", fs)
-
-	http.HandleFunc("/save-task", saveTaskHandler)
-	http.HandleFunc("/api/templates", getTemplatesHandler)
-
-	http.HandleFunc("/api/login", loginHandler)
-	http.HandleFunc("/api/logout", logoutHandler)
-	http.HandleFunc("/api/whoami", whoamiHandler)
-
-	// --- Защита админки через сервер ---
-	http.HandleFunc("/protected/admin.html", adminPageHandler)
-
-	http.HandleFunc("/api/render-status", renderStatusHandler)
-
-	http.HandleFunc("/api/render-history", renderHistoryHandler)
+	c, err := loadConfig(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg = c
 
-	http.HandleFunc("/api/admin/stats", adminStatsHandler)
-	http.HandleFunc("/api/admin/renders", adminRendersHandler)
+	if err := migrateDB(); err != nil {
+		log.Fatal("Ошибка миграции БД: ", err)
+	}
 
-	http.HandleFunc("/api/admin/renders/delete", adminDeleteRenderHandler)
+	backend, err := newRenderBackend(cfg.RenderBackend, cfg.NexrenderURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	renderer = backend
 
-	http.HandleFunc("/api/admin/renders/restart", adminRestartRenderHandler)
+	_ = mime.AddExtensionType(".js", "application/javascript")
 
-	http.HandleFunc("/api/admin/users/create", adminCreateUserHandler)
+	fs := http.FileServer(http.Dir(cfg.StaticDir))
+	http.Handle("/", fs)
 
-	http.HandleFunc("/api/admin/users", adminUsersListHandler)
-	http.HandleFunc("/api/admin/users/delete", adminDeleteUserHandler)
-	http.HandleFunc("/api/admin/users/block", adminBlockUserHandler)
-	http.HandleFunc("/api/admin/users/unblock", adminUnblockUserHandler)
+	// Маршруты API и кому они открыты — в appRoutes (auth.go)
+	registerRoutes(http.DefaultServeMux)
 
 	startStatusUpdater()
+	startMarketWatcher()
+	startInputJanitor()
 
-	http.Handle("/output/", http.StripPrefix("/output/", http.FileServer(http.Dir("C:/Users/Yarik/Downloads/DIPLOMA/output"))))
+	http.Handle("/output/", http.StripPrefix("/output/", http.FileServer(http.Dir(cfg.OutputDir))))
 
-	port := ":8080"
-	fmt.Println("Сервер запущен на http://192.168.0.128" + port)
-	log.Fatal(http.ListenAndServe(port, nil))
+	fmt.Println("Сервер запущен на " + cfg.PublicURL)
+	log.Fatal(http.ListenAndServe(cfg.Listen, nil))
 	log.Println("main.go дошёл до конца, почему-то выходим…")
 }
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Карты (шаблоны 15.x): метки по координатам, подсветка регионов, виджеты с текстом
+
+// mapCalibration — привязка карты шаблона: две точки с известными координатами
+// и их положение в пикселях композиции. Между ними — линейное преобразование
+// в выбранной проекции.
+type mapCalibration struct {
+	Projection string  `json:"projection"` // mercator (по умолчанию) или equirect
+	Lat1       float64 `json:"lat1"`
+	Lon1       float64 `json:"lon1"`
+	X1         float64 `json:"x1"`
+	Y1         float64 `json:"y1"`
+	Lat2       float64 `json:"lat2"`
+	Lon2       float64 `json:"lon2"`
+	X2         float64 `json:"x2"`
+	Y2         float64 `json:"y2"`
+}
+
+// Настройки карт (options в схеме шаблона). Сколько меток — задаёт группа points.
+type mapOptions struct {
+	Calibration mapCalibration `json:"calibration"`
+	Width       float64        `json:"width"`
+	Height      float64        `json:"height"`
+	Regions     []string       `json:"regions"` // коды регионов, для которых в шаблоне есть слои
+}
+
+func (c mapCalibration) projectY(lat float64) float64 {
+	if c.Projection == "equirect" {
+		return lat
+	}
+	phi := lat * math.Pi / 180
+	return math.Log(math.Tan(math.Pi/4 + phi/2))
+}
+
+// project переводит широту/долготу в пиксели композиции
+func (c mapCalibration) project(lat, lon float64) (float64, float64, error) {
+	if c.Lon1 == c.Lon2 || c.Lat1 == c.Lat2 {
+		return 0, 0, fmt.Errorf("Ошибка в настройках шаблона: точки калибровки карты совпадают")
+	}
+	x := c.X1 + (lon-c.Lon1)*(c.X2-c.X1)/(c.Lon2-c.Lon1)
+	y1, y2 := c.projectY(c.Lat1), c.projectY(c.Lat2)
+	y := c.Y1 + (c.projectY(lat)-y1)*(c.Y2-c.Y1)/(y2-y1)
+	return x, y, nil
+}
+
+// Справочник населённых пунктов (cfg.GazetteerPath): CSV «название;широта;долгота»
+var gazetteer = struct {
+	sync.Mutex
+	modTime time.Time
+	places  map[string][2]float64
+}{}
+
+// lookupPlace ищет координаты по названию в справочнике (без учёта регистра и ё/е)
+func lookupPlace(name string) (float64, float64, bool) {
+	gazetteer.Lock()
+	defer gazetteer.Unlock()
+	info, err := os.Stat(cfg.GazetteerPath)
+	if err != nil {
+		return 0, 0, false
+	}
+	if !info.ModTime().Equal(gazetteer.modTime) {
+		data, err := os.ReadFile(cfg.GazetteerPath)
+		if err != nil {
+			return 0, 0, false
+		}
+		// В справочнике нет строки заголовка, поэтому добавляем её сами
+		table, err := parseCSV(append([]byte("name;lat;lon\n"), data...))
+		if err != nil {
+			return 0, 0, false
+		}
+		places := make(map[string][2]float64)
+		for _, row := range table.Rows {
+			lat, ok1 := toFloat(row[1])
+			lon, ok2 := toFloat(row[2])
+			if ok1 && ok2 {
+				places[placeKey(row[0])] = [2]float64{lat, lon}
+			}
+		}
+		gazetteer.places = places
+		gazetteer.modTime = info.ModTime()
+	}
+	p, ok := gazetteer.places[placeKey(name)]
+	return p[0], p[1], ok
+}
+
+func placeKey(name string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), "ё", "е")
+}
+
+// buildMapParams переводит метки в пиксели карты и отмечает подсвеченные регионы.
+//
+// params: {"points": [{"name": "Москва"}, {"name": "Точка", "lat": 55.7, "lon": 37.6}], "regions": ["RU-MOW"]}
+// Виджеты с текстом ({"widgets": [{"title": "...", "text": "..."}]}) раскладываются схемой без обработки.
+// В каждую метку добавляются x, y и position ([x, y]), в params — regionLayers
+// со всеми регионами шаблона и их прозрачностью.
+func buildMapParams(schema *TemplateSchema, params map[string]interface{}) error {
+	opts := mapOptions{Width: 1920, Height: 1080}
+	if err := schema.decodeOptions(&opts); err != nil {
+		return err
+	}
+	g, err := schema.group("points")
+	if err != nil {
+		return err
+	}
+
+	points := groupItems(params, "points")
+	if len(points) > g.Max {
+		return invalidf("На карте максимум %d меток, передано %d", g.Max, len(points))
+	}
+	for i, p := range points {
+		name := toString(p["name"])
+		lat, okLat := toFloat(p["lat"])
+		lon, okLon := toFloat(p["lon"])
+		if !okLat || !okLon {
+			var found bool
+			lat, lon, found = lookupPlace(name)
+			if !found {
+				return invalidf("Метка %d: %q нет в справочнике, укажите координаты", i+1, name)
+			}
+			p["lat"], p["lon"] = lat, lon
+		}
+		if lat < -85 || lat > 85 || lon < -180 || lon > 180 {
+			return invalidf("Метка %d: неверные координаты", i+1)
+		}
+		x, y, err := opts.Calibration.project(lat, lon)
+		if err != nil {
+			return err
+		}
+		if x < 0 || y < 0 || x > opts.Width || y > opts.Height {
+			addWarning(params, "Метка %d (%s) не попадает в кадр карты", i+1, name)
+		}
+		p["x"], p["y"] = x, y
+		p["position"] = []float64{x, y}
+	}
+
+	selected := make(map[string]bool)
+	if regions, ok := params["regions"].([]interface{}); ok {
+		known := make(map[string]bool)
+		for _, code := range opts.Regions {
+			known[code] = true
+		}
+		for _, r := range regions {
+			code := strings.ToUpper(toString(r))
+			if !known[code] {
+				return invalidf("В шаблоне нет региона %q", code)
+			}
+			selected[code] = true
+		}
+	}
+	var layers []interface{}
+	for _, code := range opts.Regions {
+		opacity := 0
+		if selected[code] {
+			opacity = 100
+		}
+		layers = append(layers, map[string]interface{}{"code": code, "opacity": opacity})
+	}
+	params["regionLayers"] = layers
+	return nil
+}
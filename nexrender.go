@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Типы задач Nexrender (https://github.com/inlife/nexrender, формат job.json)
+
+type NexrenderJob struct {
+	UID            string                 `json:"uid,omitempty"`
+	State          string                 `json:"state,omitempty"`
+	Type           string                 `json:"type,omitempty"`
+	Priority       int                    `json:"priority,omitempty"`
+	Tags           string                 `json:"tags,omitempty"`
+	Template       NexrenderTemplate      `json:"template"`
+	Assets         []NexrenderAsset       `json:"assets"`
+	Actions        NexrenderActions       `json:"actions"`
+	Data           map[string]interface{} `json:"data,omitempty"`
+	RenderProgress float64                `json:"renderProgress,omitempty"`
+	Output         string                 `json:"output,omitempty"`
+	Error          interface{}            `json:"error,omitempty"`
+	Executor       string                 `json:"executor,omitempty"` // имя воркера, который взял задачу
+	CreatedAt      string                 `json:"createdAt,omitempty"`
+	UpdatedAt      string                 `json:"updatedAt,omitempty"`
+	StartedAt      string                 `json:"startedAt,omitempty"`
+	FinishedAt     string                 `json:"finishedAt,omitempty"`
+}
+
+type NexrenderTemplate struct {
+	Src         string `json:"src"`
+	Composition string `json:"composition"`
+	Output      string `json:"output,omitempty"`
+}
+
+// NexrenderAsset — файл (image, audio, video) или значение свойства слоя (data).
+// Value без omitempty по значению: пустая строка и 0 — тоже значения (очистить текст, скрыть слой).
+type NexrenderAsset struct {
+	Type        string      `json:"type"`
+	Src         string      `json:"src,omitempty"`
+	Composition string      `json:"composition,omitempty"`
+	LayerName   string      `json:"layerName,omitempty"`
+	Property    string      `json:"property,omitempty"`
+	Value       interface{} `json:"value,omitempty"`
+	Expression  string      `json:"expression,omitempty"`
+}
+
+// NexrenderAction — описание action (module и его параметры зависят от модуля)
+type NexrenderAction map[string]interface{}
+
+type NexrenderActions struct {
+	Prerender  []NexrenderAction `json:"prerender,omitempty"`
+	Postrender []NexrenderAction `json:"postrender"`
+}
+
+// NexrenderWorker — воркер, который сейчас рендерит задачи
+type NexrenderWorker struct {
+	Name string   `json:"name"`
+	Jobs []string `json:"jobs"`
+}
+
+// errJobNotFound — задачи нет на сервере (удалена или сервер перезапускался)
+var errJobNotFound = errors.New("задача не найдена")
+
+// nexrenderBackend — клиент HTTP API nexrender-server
+type nexrenderBackend struct {
+	baseURL string
+	client  *http.Client
+}
+
+func newNexrenderBackend(baseURL string) *nexrenderBackend {
+	return &nexrenderBackend{baseURL: baseURL, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// do выполняет запрос к API и разбирает JSON-ответ в out (если out != nil)
+func (b *nexrenderBackend) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, b.baseURL+"/api/v1"+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusNotFound && strings.HasPrefix(path, "/jobs/") {
+		return fmt.Errorf("nexrender: %s %s: %w", method, path, errJobNotFound)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("nexrender: %s %s: %d %s", method, path, resp.StatusCode, string(respBody))
+	}
+	if out == nil {
+		return nil
+	}
+	if len(respBody) == 0 {
+		return fmt.Errorf("empty response from nexrender")
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+func (b *nexrenderBackend) Submit(job *NexrenderJob) (string, error) {
+	var created NexrenderJob
+	if err := b.do(http.MethodPost, "/jobs", job, &created); err != nil {
+		return "", err
+	}
+	if created.UID == "" {
+		return "", fmt.Errorf("Ошибка: не удалось получить uid из ответа nexrender")
+	}
+	log.Println("Ответ nexrender: задача создана", created.UID)
+	return created.UID, nil
+}
+
+func (b *nexrenderBackend) Status(uid string) (*NexrenderJob, error) {
+	var job NexrenderJob
+	if err := b.do(http.MethodGet, "/jobs/"+uid, nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (b *nexrenderBackend) List() ([]NexrenderJob, error) {
+	var jobs []NexrenderJob
+	if err := b.do(http.MethodGet, "/jobs", nil, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Update меняет поля задачи (например, priority); сервер сливает их с текущей задачей
+func (b *nexrenderBackend) Update(uid string, fields map[string]interface{}) (*NexrenderJob, error) {
+	var job NexrenderJob
+	if err := b.do(http.MethodPut, "/jobs/"+uid, fields, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Cancel удаляет задачу с сервера: из очереди её уже никто не возьмёт,
+// а воркер, который её рендерит, не сможет отчитаться о ней и бросит её.
+func (b *nexrenderBackend) Cancel(uid string) error {
+	return b.do(http.MethodDelete, "/jobs/"+uid, nil, nil)
+}
+
+func (b *nexrenderBackend) Health() error {
+	return b.do(http.MethodGet, "/health", nil, nil)
+}
+
+// Workers — воркеры, у которых сейчас есть задачи. Отдельного списка воркеров
+// в API сервера нет, поэтому собираем его по полю executor задач в работе.
+func (b *nexrenderBackend) Workers() ([]NexrenderWorker, error) {
+	jobs, err := b.List()
+	if err != nil {
+		return nil, err
+	}
+	return workersFromJobs(jobs), nil
+}
+
+func workersFromJobs(jobs []NexrenderJob) []NexrenderWorker {
+	var workers []NexrenderWorker
+	index := make(map[string]int)
+	for _, j := range jobs {
+		if j.Executor == "" || renderStateFinal(j.State) {
+			continue
+		}
+		i, ok := index[j.Executor]
+		if !ok {
+			i = len(workers)
+			index[j.Executor] = i
+			workers = append(workers, NexrenderWorker{Name: j.Executor})
+		}
+		workers[i].Jobs = append(workers[i].Jobs, j.UID)
+	}
+	return workers
+}
+
+// renderStateFinal — задача Nexrender больше не изменится
+func renderStateFinal(state string) bool {
+	return state == "finished" || state == "errored" || state == "failed" || state == "canceled"
+}
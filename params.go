@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Вспомогательные функции для разбора params, пришедших из JSON формы
+
+// toFloat понимает числа из JSON и строки вида "12,5" / "1 200"
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case string:
+		s := strings.TrimSpace(n)
+		s = strings.ReplaceAll(s, " ", "")
+		s = strings.ReplaceAll(s, " ", "")
+		s = strings.TrimSuffix(s, "%")
+		s = strings.ReplaceAll(s, ",", ".")
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return 0, false
+		}
+		return f, true
+	}
+	return 0, false
+}
+
+func toString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// textParam достаёт из params строку без крайних пробелов. Не строка (число, массив) — ошибка редактора.
+func textParam(params map[string]interface{}, key string) (string, bool) {
+	switch v := params[key].(type) {
+	case nil:
+		return "", true
+	case string:
+		return strings.TrimSpace(v), true
+	}
+	return "", false
+}
+
+// formatNumberRu форматирует число по-русски: пробел между разрядами, запятая перед дробью.
+// decimals < 0 — до двух знаков после запятой без лишних нулей.
+func formatNumberRu(v float64, decimals int) string {
+	var s string
+	if decimals < 0 {
+		s = strconv.FormatFloat(math.Abs(v), 'f', 2, 64)
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	} else {
+		s = strconv.FormatFloat(math.Abs(v), 'f', decimals, 64)
+	}
+	intPart, frac, _ := strings.Cut(s, ".")
+	var b strings.Builder
+	if v < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteString("-")
+	}
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(" ")
+		}
+		b.WriteRune(c)
+	}
+	if frac != "" {
+		b.WriteString(",")
+		b.WriteString(frac)
+	}
+	return b.String()
+}
+
+// hexToColor переводит "#RRGGBB" в цвет для свойства After Effects ([r, g, b] от 0 до 1)
+func hexToColor(hex string) ([]float64, error) {
+	h := strings.TrimPrefix(strings.TrimSpace(hex), "#")
+	if len(h) != 6 {
+		return nil, fmt.Errorf("неверный цвет %q", hex)
+	}
+	n, err := strconv.ParseUint(h, 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("неверный цвет %q", hex)
+	}
+	return []float64{
+		float64(n>>16&0xff) / 255,
+		float64(n>>8&0xff) / 255,
+		float64(n&0xff) / 255,
+	}, nil
+}
+
+// addWarning добавляет предупреждение, которое saveTaskHandler вернёт редактору вместе с uid
+func addWarning(params map[string]interface{}, format string, args ...interface{}) {
+	warnings, _ := params["warnings"].([]interface{})
+	params["warnings"] = append(warnings, fmt.Sprintf(format, args...))
+}
+
+// truncateText обрезает текст до limit символов с многоточием
+func truncateText(s string, limit int) (string, bool) {
+	r := []rune(s)
+	if limit <= 0 || len(r) <= limit {
+		return s, false
+	}
+	return string(r[:limit-1]) + "…", true
+}
@@ -0,0 +1,60 @@
+package main
+
+// Цитата (шаблон 18.4): текст, автор, должность/регалии и необязательное фото
+
+// Настройки цитаты (options в схеме шаблона)
+type quoteOptions struct {
+	MaxQuote    int `json:"maxQuote"`    // символов в цитате
+	MaxAuthor   int `json:"maxAuthor"`   // символов в имени автора
+	MaxPosition int `json:"maxPosition"` // символов в должности/регалиях
+}
+
+// buildQuoteParams проверяет поля цитаты.
+//
+// params: {"quote": "...", "author": "...", "position": "..."}, фото автора — файл author_photo.
+// Без фото и без должности шаблон перестраивается: в params добавляются photoOpacity и positionOpacity (0 или 100).
+func buildQuoteParams(schema *TemplateSchema, params map[string]interface{}) error {
+	opts := quoteOptions{MaxQuote: 300, MaxAuthor: 60, MaxPosition: 120}
+	if err := schema.decodeOptions(&opts); err != nil {
+		return err
+	}
+
+	quote, ok := textParam(params, "quote")
+	if !ok {
+		return invalidf("Текст цитаты должен быть строкой")
+	}
+	if quote == "" {
+		return invalidf("Не указан текст цитаты")
+	}
+	if len([]rune(quote)) > opts.MaxQuote {
+		return invalidf("Цитата длиннее %d символов", opts.MaxQuote)
+	}
+	author, ok := textParam(params, "author")
+	if !ok {
+		return invalidf("Автор цитаты должен быть строкой")
+	}
+	if author == "" {
+		return invalidf("Не указан автор цитаты")
+	}
+	if len([]rune(author)) > opts.MaxAuthor {
+		return invalidf("Имя автора длиннее %d символов", opts.MaxAuthor)
+	}
+	position, ok := textParam(params, "position")
+	if !ok {
+		return invalidf("Должность должна быть строкой")
+	}
+	if len([]rune(position)) > opts.MaxPosition {
+		return invalidf("Должность длиннее %d символов", opts.MaxPosition)
+	}
+	params["quote"], params["author"], params["position"] = quote, author, position
+
+	params["photoOpacity"] = 0
+	if toString(params["photoPath"]) != "" {
+		params["photoOpacity"] = 100
+	}
+	params["positionOpacity"] = 0
+	if position != "" {
+		params["positionOpacity"] = 100
+	}
+	return nil
+}
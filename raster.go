@@ -0,0 +1,191 @@
+package main
+
+import (
+	"image"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Растровые шаблоны 18.x: цитата с сайта, проезд по сайту, разговор по телефону, портреты
+
+// Настройки цитаты с сайта и проезда по сайту (options в схеме шаблона)
+type siteOptions struct {
+	PageWidth      float64 `json:"pageWidth"`      // ширина скриншота в композиции, px
+	ViewportHeight float64 `json:"viewportHeight"` // высота окна браузера; 0 — без прокрутки (18.1)
+	Padding        float64 `json:"padding"`        // отступ рамки выделения от текста, px
+}
+
+func imageSize(path string) (int, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	ic, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, err
+	}
+	return ic.Width, ic.Height, nil
+}
+
+// buildSiteParams переводит рамку выделения из пикселей скриншота в пиксели композиции.
+//
+// params: {"source": "rbc.ru", "highlight": {"x": 120, "y": 840, "width": 900, "height": 160}},
+// скриншот — файл screenshot. Добавляются highlightPosition (центр рамки) и highlightSize,
+// для проезда по сайту — scrollOffset: на сколько сдвинуть страницу вверх, чтобы рамка оказалась в центре окна.
+func buildSiteParams(schema *TemplateSchema, params map[string]interface{}) error {
+	opts := siteOptions{PageWidth: 1600, Padding: 10}
+	if err := schema.decodeOptions(&opts); err != nil {
+		return err
+	}
+	path := toString(params["screenshotPath"])
+	if path == "" {
+		return invalidf("Не загружен скриншот страницы")
+	}
+	imgW, imgH, err := imageSize(path)
+	if err != nil {
+		return invalidf("Не удалось прочитать скриншот: %v", err)
+	}
+
+	h, _ := params["highlight"].(map[string]interface{})
+	if h == nil {
+		return invalidf("Не указана рамка выделения")
+	}
+	var rect [4]float64
+	for i, key := range []string{"x", "y", "width", "height"} {
+		v, ok := toFloat(h[key])
+		if !ok || v < 0 {
+			return invalidf("Рамка выделения: неверное значение %s", key)
+		}
+		rect[i] = v
+	}
+	x, y, w, hh := rect[0], rect[1], rect[2], rect[3]
+	if w == 0 || hh == 0 || x+w > float64(imgW) || y+hh > float64(imgH) {
+		return invalidf("Рамка выделения выходит за скриншот (%d×%d)", imgW, imgH)
+	}
+
+	k := opts.PageWidth / float64(imgW)
+	params["highlightPosition"] = []float64{(x + w/2) * k, (y + hh/2) * k}
+	params["highlightSize"] = []float64{w*k + 2*opts.Padding, hh*k + 2*opts.Padding}
+
+	if opts.ViewportHeight > 0 {
+		pageH := float64(imgH) * k
+		offset := (y+hh/2)*k - opts.ViewportHeight/2
+		// Не прокручиваем дальше начала и конца страницы
+		if offset > pageH-opts.ViewportHeight {
+			offset = pageH - opts.ViewportHeight
+		}
+		if offset < 0 {
+			offset = 0
+		}
+		if hh*k+2*opts.Padding > opts.ViewportHeight {
+			addWarning(params, "Выделенный фрагмент выше окна браузера и виден не целиком")
+		}
+		params["scrollOffset"] = offset
+	}
+	return nil
+}
+
+// Настройки разговора по телефону. Сколько реплик — задаёт группа lines.
+type dialogOptions struct {
+	MaxChars int `json:"maxChars"` // символов в одной реплике
+}
+
+// buildDialogParams раскладывает расшифровку разговора по репликам двух собеседников.
+//
+// params: {"speakers": [{"name": "Собеседник 1"}, {"name": "Собеседник 2"}],
+// "lines": [{"speaker": 1, "text": "..."}, ...]}, фото собеседников — файлы speaker_img_%d.
+// В каждую реплику добавляются name, side (left/right) и leftOpacity/rightOpacity, в params — lineCount.
+func buildDialogParams(schema *TemplateSchema, params map[string]interface{}) error {
+	opts := dialogOptions{MaxChars: 140}
+	if err := schema.decodeOptions(&opts); err != nil {
+		return err
+	}
+	g, err := schema.group("lines")
+	if err != nil {
+		return err
+	}
+	speakers := groupItems(params, "speakers")
+	if len(speakers) != 2 {
+		return invalidf("В разговоре должно быть два собеседника, передано %d", len(speakers))
+	}
+	for i, s := range speakers {
+		if strings.TrimSpace(toString(s["name"])) == "" {
+			return invalidf("Собеседник %d: не указано имя", i+1)
+		}
+	}
+	lines := groupItems(params, "lines")
+	if len(lines) == 0 {
+		return invalidf("Не переданы реплики")
+	}
+	if len(lines) > g.Max {
+		return invalidf("В шаблоне максимум %d реплик, передано %d", g.Max, len(lines))
+	}
+	for i, line := range lines {
+		n, ok := toFloat(line["speaker"])
+		if !ok || (n != 1 && n != 2) {
+			return invalidf("Реплика %d: собеседник должен быть 1 или 2", i+1)
+		}
+		text, truncated := truncateText(strings.TrimSpace(toString(line["text"])), opts.MaxChars)
+		if text == "" {
+			return invalidf("Реплика %d: пустой текст", i+1)
+		}
+		if truncated {
+			addWarning(params, "Реплика %d обрезана до %d символов", i+1, opts.MaxChars)
+			line["text"] = text
+		}
+		line["name"] = toString(speakers[int(n)-1]["name"])
+		if n == 1 {
+			line["side"], line["leftOpacity"], line["rightOpacity"] = "left", 100, 0
+		} else {
+			line["side"], line["leftOpacity"], line["rightOpacity"] = "right", 0, 100
+		}
+	}
+	params["lineCount"] = len(lines)
+	return nil
+}
+
+// Настройки портретов. Сколько портретов — задаёт группа portraits.
+type portraitsOptions struct {
+	MaxName     int `json:"maxName"`     // символов в имени
+	MaxPosition int `json:"maxPosition"` // символов в должности
+}
+
+// buildPortraitsParams проверяет, что у каждого портрета есть фото и подпись.
+//
+// params: {"portraits": [{"name": "...", "position": "..."}, ...]}, фото — файлы portrait_img_%d,
+// обрезанные под рамку шаблона (width/height поля). В params добавляется portraitCount.
+func buildPortraitsParams(schema *TemplateSchema, params map[string]interface{}) error {
+	opts := portraitsOptions{MaxName: 40, MaxPosition: 80}
+	if err := schema.decodeOptions(&opts); err != nil {
+		return err
+	}
+	g, err := schema.group("portraits")
+	if err != nil {
+		return err
+	}
+	portraits := groupItems(params, "portraits")
+	if len(portraits) < g.Min || len(portraits) > g.Max {
+		return invalidf("В шаблоне должно быть от %d до %d портретов, передано %d", g.Min, g.Max, len(portraits))
+	}
+	for i, p := range portraits {
+		if toString(params["imagePath_"+strconv.Itoa(i+1)]) == "" {
+			return invalidf("Портрет %d: не загружено фото", i+1)
+		}
+		if strings.TrimSpace(toString(p["name"])) == "" {
+			return invalidf("Портрет %d: не указано имя", i+1)
+		}
+		for _, f := range []struct {
+			key   string
+			limit int
+		}{{"name", opts.MaxName}, {"position", opts.MaxPosition}} {
+			if cut, truncated := truncateText(toString(p[f.key]), f.limit); truncated {
+				addWarning(params, "Портрет %d: текст обрезан до %d символов", i+1, f.limit)
+				p[f.key] = cut
+			}
+		}
+	}
+	params["portraitCount"] = len(portraits)
+	return nil
+}
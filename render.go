@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// renderBackend — куда уходят задачи на рендер. Настоящий — nexrender-server,
+// для разработки и тестов без After Effects — fakeBackend внутри процесса.
+type renderBackend interface {
+	// Submit отправляет задачу и возвращает её uid
+	Submit(job *NexrenderJob) (string, error)
+	// Status возвращает задачу с текущими state, renderProgress и output
+	Status(uid string) (*NexrenderJob, error)
+	List() ([]NexrenderJob, error)
+	Update(uid string, fields map[string]interface{}) (*NexrenderJob, error)
+	// Cancel снимает задачу из очереди или останавливает рендер
+	Cancel(uid string) error
+	Health() error
+	Workers() ([]NexrenderWorker, error)
+}
+
+// renderer выбирается при старте (render_backend = fake — без Nexrender)
+var renderer renderBackend = newNexrenderBackend(cfg.NexrenderURL)
+
+// newRenderBackend создаёт бэкенд по имени: nexrender (по умолчанию) или fake
+func newRenderBackend(name, nexrenderURL string) (renderBackend, error) {
+	switch name {
+	case "", "nexrender":
+		return newNexrenderBackend(nexrenderURL), nil
+	case "fake":
+		return newFakeBackend(10 * time.Second), nil
+	}
+	return nil, fmt.Errorf("неизвестный бэкенд рендера %q", name)
+}
+
+// fakeBackend имитирует nexrender-server: задача проходит те же состояния
+// (queued → picked → render:* → finished) с растущим renderProgress.
+// По окончании в output пишется файл-заглушка.
+// data.fakeState = "errored" в задаче — рендер упадёт на середине.
+// Вебхуки из actions (action-webhook) вызываются, как у Nexrender, на prerender и postrender.
+type fakeBackend struct {
+	duration time.Duration // сколько «рендерится» одна задача
+	mu       sync.Mutex
+	seq      int
+	jobs     map[string]*fakeJob
+}
+
+type fakeJob struct {
+	job       NexrenderJob
+	created   time.Time
+	failing   bool
+	prerender bool // вебхуки prerender уже вызваны
+	finished  bool
+}
+
+// Этапы рендера Nexrender и доля времени задачи, с которой этап начинается
+var fakeStages = []struct {
+	state string
+	at    float64
+}{
+	{"queued", 0},
+	{"picked", 0.1},
+	{"render:setup", 0.15},
+	{"render:predownload", 0.2},
+	{"render:download", 0.25},
+	{"render:prerender", 0.3},
+	{"render:script", 0.35},
+	{"render:dorender", 0.4},
+	{"render:postrender", 0.9},
+	{"finished", 1},
+}
+
+func newFakeBackend(duration time.Duration) *fakeBackend {
+	return &fakeBackend{duration: duration, jobs: make(map[string]*fakeJob)}
+}
+
+func (f *fakeBackend) Submit(job *NexrenderJob) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	uid := fmt.Sprintf("fake-%d-%d", time.Now().UnixNano(), f.seq)
+	j := &fakeJob{job: *job, created: time.Now(), failing: toString(job.Data["fakeState"]) == "errored"}
+	j.job.UID = uid
+	j.job.State = "queued"
+	j.job.CreatedAt = j.created.Format(time.RFC3339)
+	f.jobs[uid] = j
+	log.Printf("FakeRender: задача %s принята (output: %s)", uid, job.Template.Output)
+	go f.run(uid)
+	return uid, nil
+}
+
+// run двигает задачу сама по себе, без опроса, — иначе вебхуки пришли бы только при запросе статуса
+func (f *fakeBackend) run(uid string) {
+	for {
+		time.Sleep(f.duration / 20)
+		f.mu.Lock()
+		j, ok := f.jobs[uid]
+		done := !ok
+		if ok {
+			f.advance(j)
+			done = renderStateFinal(j.job.State)
+		}
+		f.mu.Unlock()
+		if done {
+			return
+		}
+	}
+}
+
+// advance пересчитывает состояние задачи по прошедшему времени
+func (f *fakeBackend) advance(j *fakeJob) {
+	if renderStateFinal(j.job.State) {
+		return
+	}
+	elapsed := float64(time.Since(j.created)) / float64(f.duration)
+	if j.failing && elapsed >= 0.5 {
+		j.job.State = "errored"
+		j.job.Error = "fake render error"
+		return
+	}
+	for _, s := range fakeStages {
+		if elapsed >= s.at {
+			j.job.State = s.state
+		}
+	}
+	if elapsed >= 0.1 {
+		j.job.Executor = "fake-worker"
+	}
+	// Прогресс растёт только на этапе dorender, как у Nexrender
+	switch {
+	case elapsed >= 0.9:
+		j.job.RenderProgress = 100
+	case elapsed > 0.4:
+		j.job.RenderProgress = (elapsed - 0.4) / 0.5 * 100
+	}
+	j.job.UpdatedAt = time.Now().Format(time.RFC3339)
+
+	if elapsed >= 0.3 && !j.prerender {
+		j.prerender = true
+		go fakeWebhooks(j.job.Actions.Prerender, j.job)
+	}
+	if j.job.State == "finished" && !j.finished {
+		j.finished = true
+		j.job.Output = j.job.Template.Output
+		j.job.FinishedAt = j.job.UpdatedAt
+		if out := j.job.Template.Output; out != "" {
+			if err := os.MkdirAll(filepath.Dir(out), 0755); err == nil {
+				_ = os.WriteFile(out, []byte("fake render "+j.job.UID+"\n"), 0644)
+			}
+		}
+		go fakeWebhooks(j.job.Actions.Postrender, j.job)
+	}
+}
+
+// fakeWebhooks вызывает action-webhook задачи, подставляя {job.uid} и {job.state}
+func fakeWebhooks(actions []NexrenderAction, job NexrenderJob) {
+	replacer := strings.NewReplacer("{job.uid}", job.UID, "{job.state}", job.State)
+	for _, a := range actions {
+		if toString(a["module"]) != "@nexrender/action-webhook" {
+			continue
+		}
+		body := make(map[string]interface{})
+		if m, ok := a["json"].(map[string]interface{}); ok {
+			for k, v := range m {
+				if s, ok := v.(string); ok {
+					v = replacer.Replace(s)
+				}
+				body[k] = v
+			}
+		}
+		data, _ := json.Marshal(body)
+		resp, err := http.Post(toString(a["url"]), "application/json", bytes.NewReader(data))
+		if err != nil {
+			log.Printf("FakeRender: вебхук %s: %v", job.UID, err)
+			continue
+		}
+		resp.Body.Close()
+	}
+}
+
+func (f *fakeBackend) Status(uid string) (*NexrenderJob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	j, ok := f.jobs[uid]
+	if !ok {
+		return nil, fmt.Errorf("fake: %s: %w", uid, errJobNotFound)
+	}
+	f.advance(j)
+	job := j.job
+	return &job, nil
+}
+
+func (f *fakeBackend) List() ([]NexrenderJob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var jobs []NexrenderJob
+	for _, j := range f.jobs {
+		f.advance(j)
+		jobs = append(jobs, j.job)
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].CreatedAt < jobs[b].CreatedAt })
+	return jobs, nil
+}
+
+func (f *fakeBackend) Update(uid string, fields map[string]interface{}) (*NexrenderJob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	j, ok := f.jobs[uid]
+	if !ok {
+		return nil, fmt.Errorf("fake: %s: %w", uid, errJobNotFound)
+	}
+	if p, ok := toFloat(fields["priority"]); ok {
+		j.job.Priority = int(p)
+	}
+	if state := toString(fields["state"]); state != "" {
+		j.job.State = state
+	}
+	job := j.job
+	return &job, nil
+}
+
+// Cancel, как и у Nexrender, удаляет задачу
+func (f *fakeBackend) Cancel(uid string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.jobs[uid]; !ok {
+		return fmt.Errorf("fake: %s: %w", uid, errJobNotFound)
+	}
+	delete(f.jobs, uid)
+	return nil
+}
+
+func (f *fakeBackend) Health() error {
+	return nil
+}
+
+func (f *fakeBackend) Workers() ([]NexrenderWorker, error) {
+	jobs, _ := f.List()
+	return workersFromJobs(jobs), nil
+}
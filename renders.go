@@ -0,0 +1,172 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// Управление задачами рендера: отмена, состояние nexrender-server
+
+// cancelRender останавливает задачу (или все части сюжета) и ставит ей статус canceled.
+// Задачи, которых уже нет на сервере, просто помечаются отменёнными.
+func cancelRender(db *sql.DB, uid string) error {
+	var id int64
+	var taskType, status string
+	err := db.QueryRow("SELECT id, COALESCE(type, ''), status FROM render_history WHERE uid = ?", uid).Scan(&id, &taskType, &status)
+	if err != nil {
+		return err
+	}
+	uids := []string{uid}
+	if taskType == "sequence" {
+		rows, err := db.Query("SELECT uid FROM render_history WHERE parent_id = ? AND status IN ('queued', 'rendering')", id)
+		if err != nil {
+			return err
+		}
+		uids = nil
+		for rows.Next() {
+			var child string
+			if err := rows.Scan(&child); err == nil {
+				uids = append(uids, child)
+			}
+		}
+		rows.Close()
+	}
+	for _, u := range uids {
+		if err := renderer.Cancel(u); err != nil && !errors.Is(err, errJobNotFound) {
+			return err
+		}
+		if _, err := db.Exec("UPDATE render_history SET status = 'canceled' WHERE uid = ?", u); err != nil {
+			return err
+		}
+		notifyRender(db, u)
+	}
+	if taskType == "sequence" {
+		if _, err = db.Exec("UPDATE render_history SET status = 'canceled' WHERE id = ?", id); err != nil {
+			return err
+		}
+		notifyRender(db, uid)
+	}
+	return nil
+}
+
+// Отмена своей задачи (админ может отменить любую).
+// POST {"uid": "..."} — задача должна быть в очереди или рендериться
+func cancelRenderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := currentUser(r)
+
+	var req struct {
+		UID string `json:"uid"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UID == "" {
+		writeJsonError(w, "uid required", http.StatusBadRequest)
+		return
+	}
+
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		writeJsonError(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+
+	var owner, status string
+	if err := db.QueryRow("SELECT username, status FROM render_history WHERE uid = ?", req.UID).Scan(&owner, &status); err != nil {
+		writeJsonError(w, "Задача не найдена", http.StatusNotFound)
+		return
+	}
+	if owner != user.Username && !user.IsAdmin() {
+		writeJsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if status != "queued" && status != "rendering" {
+		writeJsonError(w, "Задача уже завершена", http.StatusConflict)
+		return
+	}
+
+	if err := cancelRender(db, req.UID); err != nil {
+		log.Printf("Ошибка отмены задачи %s: %v", req.UID, err)
+		writeJsonError(w, "Ошибка отмены задачи: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	log.Printf("Задача %s отменена (%s)", req.UID, user.Username)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"result": "ok"})
+}
+
+// Задачи и воркеры nexrender-server (ТОЛЬКО для админа!)
+// GET /api/admin/nexrender — {"healthy": true, "workers": [...], "jobs": [...]}
+func adminNexrenderHandler(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]interface{}{"healthy": true}
+	if err := renderer.Health(); err != nil {
+		resp["healthy"] = false
+		resp["error"] = err.Error()
+	} else {
+		if jobs, err := renderer.List(); err == nil {
+			resp["jobs"] = jobs
+		} else {
+			resp["error"] = err.Error()
+		}
+		if workers, err := renderer.Workers(); err == nil {
+			resp["workers"] = workers
+		} else {
+			resp["error"] = err.Error()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Приоритет задачи в очереди nexrender-server (ТОЛЬКО для админа!)
+// POST {"uid": "...", "priority": 10} — чем больше, тем раньше задачу возьмёт воркер
+func adminRenderPriorityHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		UID      string `json:"uid"`
+		Priority *int   `json:"priority"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UID == "" || req.Priority == nil {
+		writeJsonError(w, "uid и priority обязательны", http.StatusBadRequest)
+		return
+	}
+
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		writeJsonError(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+
+	var status string
+	if err := db.QueryRow("SELECT status FROM render_history WHERE uid = ?", req.UID).Scan(&status); err != nil {
+		writeJsonError(w, "Задача не найдена", http.StatusNotFound)
+		return
+	}
+	if status != "queued" {
+		writeJsonError(w, "Приоритет меняется только у задачи в очереди", http.StatusConflict)
+		return
+	}
+
+	job, err := renderer.Update(req.UID, map[string]interface{}{"priority": *req.Priority})
+	if errors.Is(err, errJobNotFound) {
+		writeJsonError(w, "Задачи нет на сервере рендера", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Ошибка смены приоритета задачи %s: %v", req.UID, err)
+		writeJsonError(w, "Ошибка смены приоритета: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	log.Printf("Задача %s: приоритет %d (%s)", req.UID, *req.Priority, currentUser(r).Username)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
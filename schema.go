@@ -0,0 +1,523 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TemplateSchema — декларативное описание полей шаблона: откуда брать значение
+// в params и в какой слой/свойство After Effects его подставить.
+// Хранится JSON-ом в templates.field_schema, так что новый шаблон
+// подключается файлом schemas/<id шаблона>.json (см. seedTemplateSchemas), а не кодом.
+type TemplateSchema struct {
+	Type        string                 `json:"type"`             // тип задачи: thesis, quote, ...
+	Composition string                 `json:"composition"`      // композиция, которую рендерит Nexrender
+	Groups      map[string]SchemaGroup `json:"groups,omitempty"` // повторяющиеся блоки (theses и т.п.)
+	Fields      []SchemaField          `json:"fields"`
+	Options     json.RawMessage        `json:"options,omitempty"` // настройки конкретного типа задачи
+}
+
+// SchemaGroup — ограничения на количество элементов массива params[<имя группы>]
+type SchemaGroup struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// SchemaField описывает одно поле шаблона.
+//
+// Для полей группы значение берётся из каждого элемента params[Group][i] по ключу Name.
+// Если в Name есть %d, значение берётся из params верхнего уровня (imagePath_1, imagePath_2, ...).
+// В Composition, LayerName и Upload %d заменяется на номер элемента (с 1),
+// а {ключ} — на значение этого ключа в элементе группы (например, слой с кодом региона).
+type SchemaField struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"` // text, number, data, image, audio, video
+	Group       string `json:"group,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Upload      string `json:"upload,omitempty"` // имя файла в multipart-форме
+	Composition string `json:"composition"`
+	LayerName   string `json:"layerName"`
+	Property    string `json:"property,omitempty"` // по умолчанию Source Text
+	Width       int    `json:"width,omitempty"`    // для image: обрезать и масштабировать под этот размер
+	Height      int    `json:"height,omitempty"`
+	Expression  bool   `json:"expression,omitempty"` // значение — выражение AE, а не готовое значение свойства
+}
+
+// taskBuilders — подготовка params для типов задач, которым мало прямого
+// копирования полей: проверка значений и вычисление производных (проценты, углы и т.п.),
+// которые затем раскладываются по слоям той же схемой
+var taskBuilders = map[string]func(schema *TemplateSchema, params map[string]interface{}) error{
+	"chart_pie":    buildPieParams,
+	"chart_donut":  buildPieParams,
+	"chart_bar":    buildBarParams,
+	"chart_series": buildSeriesParams,
+	"table":        buildTableParams,
+	"birzha":       buildBirzhaParams,
+	"demilit":      buildDemilitParams,
+	"map":          buildMapParams,
+	"slideshow":    buildSlideshowParams,
+	"waffle":       buildWaffleParams,
+	"list":         buildListParams,
+	"bigtext":      buildBigTextParams,
+	"grafspravka":  buildBigTextParams,
+	"site_quote":   buildSiteParams,
+	"site_scroll":  buildSiteParams,
+	"dialog":       buildDialogParams,
+	"portraits":    buildPortraitsParams,
+	"quote":        buildQuoteParams,
+}
+
+// validationError — ошибка в данных, которые прислал редактор (а не в шаблоне или БД).
+// Такие ошибки возвращаются клиенту как 400 с текстом, понятным редактору.
+type validationError struct {
+	msg string
+}
+
+func (e *validationError) Error() string { return e.msg }
+
+func invalidf(format string, args ...interface{}) error {
+	return &validationError{msg: fmt.Sprintf(format, args...)}
+}
+
+// errorStatus подбирает HTTP-код для ошибки сборки задачи
+func errorStatus(err error) int {
+	var v *validationError
+	if errors.As(err, &v) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// taskPublishers вызываются, когда рендер задачи готов (например, чтобы прибавить
+// вышедшие в эфир цифры к итогам) — один раз на задачу, даже если её перезапускали.
+var taskPublishers = map[string]func(params map[string]interface{}) error{
+	"demilit": publishDemilitTotals,
+}
+
+// taskServerParams — ключи params, которые считает сам сервер: присланное клиентом отбрасывается
+var taskServerParams = map[string][]string{
+	"demilit":    {"totals", "published"},
+	"transition": {"join"}, // склейку сюжета задаёт только submitSequenceJoin
+}
+
+// dropServerParams убирает из params клиента значения, которые должен посчитать сервер
+func dropServerParams(taskType string, params map[string]interface{}) {
+	for _, key := range taskServerParams[taskType] {
+		delete(params, key)
+	}
+}
+
+// publishTask вызывает taskPublishers для готовой задачи uid и отмечает её в params.published
+func publishTask(db *sql.DB, uid string) {
+	var taskType, paramsStr sql.NullString
+	if err := db.QueryRow("SELECT type, params FROM render_history WHERE uid = ?", uid).Scan(&taskType, &paramsStr); err != nil {
+		return
+	}
+	publish, ok := taskPublishers[taskType.String]
+	if !ok {
+		return
+	}
+	var params map[string]interface{}
+	if err := json.Unmarshal([]byte(paramsStr.String), &params); err != nil || params["published"] == true {
+		return
+	}
+	if err := publish(params); err != nil {
+		log.Printf("Задача %s: ошибка сохранения данных задачи: %v", uid, err)
+		return
+	}
+	_, err := db.Exec("UPDATE render_history SET params = json_set(params, '$.published', json('true')) WHERE uid = ?", uid)
+	if err != nil {
+		log.Printf("Задача %s: не удалось отметить публикацию: %v", uid, err)
+	}
+}
+
+func isFileFieldType(t string) bool {
+	return t == "image" || t == "audio" || t == "video"
+}
+
+// indexed подставляет номер элемента вместо всех %d в строке
+func indexed(s string, i int) string {
+	return strings.ReplaceAll(s, "%d", strconv.Itoa(i))
+}
+
+var itemKeyRe = regexp.MustCompile(`\{(\w+)\}`)
+
+// itemPath — indexed плюс подстановка {ключ} из элемента группы
+func itemPath(s string, i int, item map[string]interface{}) string {
+	s = indexed(s, i)
+	if item == nil {
+		return s
+	}
+	return itemKeyRe.ReplaceAllStringFunc(s, func(m string) string {
+		return toString(item[m[1:len(m)-1]])
+	})
+}
+
+func validateSchema(s *TemplateSchema) error {
+	if s.Composition == "" {
+		return fmt.Errorf("не указана composition")
+	}
+	for _, f := range s.Fields {
+		if f.Name == "" || f.LayerName == "" || f.Composition == "" {
+			return fmt.Errorf("у поля %q должны быть заданы name, composition и layerName", f.Name)
+		}
+		switch f.Type {
+		case "text", "number":
+		case "data":
+			if f.Property == "" {
+				return fmt.Errorf("у поля %q типа data должен быть задан property", f.Name)
+			}
+		case "image", "audio", "video":
+		default:
+			return fmt.Errorf("у поля %q неизвестный тип %q", f.Name, f.Type)
+		}
+	}
+	return nil
+}
+
+func loadTemplateSchema(templateId string) (*TemplateSchema, error) {
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	var raw sql.NullString
+	err = db.QueryRow("SELECT field_schema FROM templates WHERE id = ?", templateId).Scan(&raw)
+	if err != nil {
+		return nil, fmt.Errorf("Шаблон %s не найден", templateId)
+	}
+	if !raw.Valid || raw.String == "" {
+		return nil, fmt.Errorf("Для шаблона %s не задана схема полей", templateId)
+	}
+	var schema TemplateSchema
+	if err := json.Unmarshal([]byte(raw.String), &schema); err != nil {
+		return nil, fmt.Errorf("Ошибка чтения схемы шаблона %s: %v", templateId, err)
+	}
+	return &schema, nil
+}
+
+// decodeOptions разбирает options схемы в настройки конкретного типа задачи
+func (s *TemplateSchema) decodeOptions(v interface{}) error {
+	if len(s.Options) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(s.Options, v); err != nil {
+		return fmt.Errorf("Ошибка в настройках шаблона: %v", err)
+	}
+	return nil
+}
+
+// group возвращает ограничения группы name. Лимиты на число элементов живут только
+// в groups, поэтому типы задач берут их отсюда, а не из options.
+func (s *TemplateSchema) group(name string) (SchemaGroup, error) {
+	g, ok := s.Groups[name]
+	if !ok || g.Max <= 0 {
+		return g, fmt.Errorf("Ошибка в настройках шаблона: не задан максимум группы %s", name)
+	}
+	return g, nil
+}
+
+// groupItems возвращает элементы params[name] как список объектов
+func groupItems(params map[string]interface{}, name string) []map[string]interface{} {
+	var items []map[string]interface{}
+	switch v := params[name].(type) {
+	case []interface{}:
+		for _, raw := range v {
+			item, _ := raw.(map[string]interface{})
+			if item == nil {
+				item = map[string]interface{}{}
+			}
+			items = append(items, item)
+		}
+	case []map[string]interface{}:
+		items = v
+	}
+	return items
+}
+
+func isEmptyValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	s, ok := v.(string)
+	return ok && s == ""
+}
+
+// skipValue — пустое значение не попадает в assets: для файлов это отсутствие файла,
+// а пустой текст передаётся как есть, чтобы очистить слой
+func skipValue(f SchemaField, v interface{}) bool {
+	if isFileFieldType(f.Type) {
+		return isEmptyValue(v)
+	}
+	return v == nil
+}
+
+func schemaAsset(f SchemaField, i int, item map[string]interface{}, v interface{}) NexrenderAsset {
+	asset := NexrenderAsset{
+		Composition: itemPath(f.Composition, i, item),
+		LayerName:   itemPath(f.LayerName, i, item),
+	}
+	if isFileFieldType(f.Type) {
+		asset.Type = f.Type
+		asset.Src = "file:///" + filepath.ToSlash(fmt.Sprint(v))
+		return asset
+	}
+	asset.Type = "data"
+	asset.Property = f.Property
+	if asset.Property == "" {
+		asset.Property = "Source Text"
+	}
+	if f.Expression {
+		asset.Expression = fmt.Sprint(v)
+		return asset
+	}
+	if f.Type == "text" {
+		if _, ok := v.(string); !ok {
+			v = fmt.Sprint(v)
+		}
+	}
+	asset.Value = v
+	return asset
+}
+
+// isTaskFile — лежит ли path в папке файлов задачи (params.input_dir;
+// у задач, отправленных до появления своих папок, — в общей cfg.InputDir)
+func isTaskFile(params map[string]interface{}, path string) bool {
+	dir := toString(params["input_dir"])
+	if dir == "" {
+		dir = cfg.InputDir
+	}
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	return !filepath.IsAbs(rel)
+}
+
+// checkTaskFiles не пускает в задачу файлы не из её папки: в файловых полях
+// могут быть только пути, которые записал сам сервер (saveSchemaUploads)
+func checkTaskFiles(schema *TemplateSchema, params map[string]interface{}) error {
+	for _, f := range schema.Fields {
+		if !isFileFieldType(f.Type) {
+			continue
+		}
+		var values []interface{}
+		if f.Group == "" {
+			values = append(values, params[f.Name])
+		} else {
+			for idx, item := range groupItems(params, f.Group) {
+				if strings.Contains(f.Name, "%d") {
+					values = append(values, params[indexed(f.Name, idx+1)])
+				} else {
+					values = append(values, item[f.Name])
+				}
+			}
+		}
+		for _, v := range values {
+			if !isEmptyValue(v) && !isTaskFile(params, fmt.Sprint(v)) {
+				return invalidf("%s: файл не из этой задачи", f.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// buildSchemaAssets превращает params в список assets Nexrender по схеме шаблона
+func buildSchemaAssets(schema *TemplateSchema, params map[string]interface{}) ([]NexrenderAsset, error) {
+	for name, g := range schema.Groups {
+		n := len(groupItems(params, name))
+		if n < g.Min {
+			return nil, invalidf("%s: нужно минимум %d элементов, передано %d", name, g.Min, n)
+		}
+		if g.Max > 0 && n > g.Max {
+			return nil, invalidf("%s: допускается максимум %d элементов, передано %d", name, g.Max, n)
+		}
+	}
+
+	var assets []NexrenderAsset
+	for _, f := range schema.Fields {
+		if f.Group == "" {
+			v := params[f.Name]
+			if f.Required && isEmptyValue(v) {
+				return nil, invalidf("не заполнено поле %s", f.Name)
+			}
+			if skipValue(f, v) {
+				continue
+			}
+			assets = append(assets, schemaAsset(f, 0, nil, v))
+			continue
+		}
+		for idx, item := range groupItems(params, f.Group) {
+			i := idx + 1
+			var v interface{}
+			if strings.Contains(f.Name, "%d") {
+				v = params[indexed(f.Name, i)]
+			} else {
+				v = item[f.Name]
+			}
+			if f.Required && isEmptyValue(v) {
+				return nil, invalidf("%s %d: не заполнено поле %s", f.Group, i, f.Name)
+			}
+			if skipValue(f, v) {
+				continue
+			}
+			assets = append(assets, schemaAsset(f, i, item, v))
+		}
+	}
+	return assets, nil
+}
+
+// uploadFileName — имя файла для загруженного поля, png для картинок (saveFile перекодирует их в PNG)
+func uploadFileName(f SchemaField, base, original string) string {
+	if f.Type == "image" {
+		return base + ".png"
+	}
+	ext := filepath.Ext(original)
+	if ext == "" {
+		switch f.Type {
+		case "audio":
+			ext = ".mp3"
+		case "video":
+			ext = ".mp4"
+		}
+	}
+	return base + ext
+}
+
+// saveUpload сохраняет один загруженный файл и подгоняет картинку под размер поля.
+// Картинку, которую надо обрезать, проверяем до сохранения: не картинка или картинка
+// меньше нужного размера — ошибка валидации (original — имя файла у пользователя).
+func saveUpload(f SchemaField, file multipart.File, original, path string) error {
+	defer file.Close()
+	crop := f.Type == "image" && f.Width > 0 && f.Height > 0
+	if crop {
+		ic, _, err := image.DecodeConfig(file)
+		if err != nil {
+			return invalidf("Файл %q не является изображением PNG или JPEG", original)
+		}
+		if ic.Width < f.Width || ic.Height < f.Height {
+			return invalidf("Изображение %q слишком маленькое: %dx%d, нужно не меньше %dx%d",
+				original, ic.Width, ic.Height, f.Width, f.Height)
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	if err := saveFile(file, path); err != nil {
+		return err
+	}
+	if crop {
+		return cropImageFile(path, f.Width, f.Height)
+	}
+	return nil
+}
+
+// saveSchemaUploads сохраняет файлы из multipart-формы, описанные в схеме (поле upload),
+// в каталог dir и прописывает их пути в params. prefix добавляется к именам полей формы
+// и файлов — у частей сюжета (sequence) свои файлы: item1_thesis_img_1, item2_...
+func saveSchemaUploads(r *http.Request, schema *TemplateSchema, params map[string]interface{}, dir, prefix string) error {
+	for _, f := range schema.Fields {
+		if f.Upload == "" || !isFileFieldType(f.Type) {
+			continue
+		}
+		if f.Group == "" {
+			file, header, err := r.FormFile(prefix + f.Upload)
+			if err != nil {
+				// Путь к файлу принимаем только от сервера
+				delete(params, f.Name)
+				continue
+			}
+			path := filepath.Join(dir, uploadFileName(f, prefix+f.Upload, header.Filename))
+			if err := saveUpload(f, file, header.Filename, path); err != nil {
+				return err
+			}
+			params[f.Name] = path
+			continue
+		}
+		for idx, item := range groupItems(params, f.Group) {
+			i := idx + 1
+			path := ""
+			if file, header, err := r.FormFile(prefix + indexed(f.Upload, i)); err == nil {
+				path = filepath.Join(dir, uploadFileName(f, prefix+indexed(f.Upload, i), header.Filename))
+				if err := saveUpload(f, file, header.Filename, path); err != nil {
+					return err
+				}
+			}
+			if strings.Contains(f.Name, "%d") {
+				params[indexed(f.Name, i)] = path
+			} else if path != "" {
+				item[f.Name] = path
+			} else {
+				delete(item, f.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Просмотр и правка схемы полей шаблона (ТОЛЬКО для админа!)
+// GET  /api/admin/templates/schema?id=66 — текущая схема
+// POST /api/admin/templates/schema?id=66 — сохранить новую (тело — JSON схемы)
+func adminTemplateSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	username := currentUser(r).Username
+
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		writeJsonError(w, "DB error", 500)
+		return
+	}
+	defer db.Close()
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJsonError(w, "id required", 400)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		schema, err := loadTemplateSchema(id)
+		if err != nil {
+			writeJsonError(w, err.Error(), 404)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(schema)
+	case http.MethodPost:
+		var schema TemplateSchema
+		if err := json.NewDecoder(r.Body).Decode(&schema); err != nil {
+			writeJsonError(w, "Bad request", 400)
+			return
+		}
+		if err := validateSchema(&schema); err != nil {
+			writeJsonError(w, "Ошибка в схеме: "+err.Error(), 400)
+			return
+		}
+		raw, _ := json.Marshal(schema)
+		res, err := db.Exec("UPDATE templates SET field_schema = ? WHERE id = ?", string(raw), id)
+		if err != nil {
+			writeJsonError(w, "DB error", 500)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			writeJsonError(w, "Шаблон не найден", 404)
+			return
+		}
+		log.Printf("Схема шаблона %s обновлена (%s)", id, username)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"result": "ok"})
+	default:
+		writeJsonError(w, "Method not allowed", 405)
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Сюжет (sequence): несколько шаблонов подряд — шапка, графики, тезис — в одном MP4.
+// Каждая часть рендерится отдельной задачей Nexrender (дочерние записи render_history
+// с parent_id). Когда все части готовы, отправляется задача перехода: она рендерит
+// переход и postrender-действием склеивает части на машине рендера (см. updateSequences).
+
+const sequenceMaxItems = 10
+
+// Переходы — обычные шаблоны каталога с типом transition (schemas/87.json и т.п.)
+
+// catalogTemplatesCond отсекает служебные шаблоны (переходы сюжетов): пользователю
+// они в каталоге не нужны, их выбирает сам сюжет
+const catalogTemplatesCond = "COALESCE(json_extract(field_schema, '$.type'), '') != 'transition'"
+
+// defaultTransitionTemplate — шаблон перехода, если сюжет не выбрал свой
+func defaultTransitionTemplate() (string, error) {
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	var id string
+	err = db.QueryRow(`SELECT id FROM templates WHERE json_extract(field_schema, '$.type') = 'transition'
+		ORDER BY id LIMIT 1`).Scan(&id)
+	if err != nil {
+		return "", fmt.Errorf("В каталоге нет шаблона перехода")
+	}
+	return id, nil
+}
+
+// setRenderParent привязывает запись render_history к сюжету
+func setRenderParent(uid string, parentID int64) error {
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Exec("UPDATE render_history SET parent_id = ? WHERE uid = ?", parentID, uid)
+	return err
+}
+
+// Отправка сюжета в рендер.
+// Форма: params = {"items": [{"template": "84", "type": "slideshow", "params": {...}}, ...], "transition": true},
+// файлы части N — с префиксом itemN_ (item2_slide_img_1 и т.п.).
+// transition: false — без переходов, id шаблона перехода — свой переход, иначе переход по умолчанию.
+func saveSequenceHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(200 << 20)
+	if err != nil {
+		writeJsonError(w, "Ошибка обработки формы", http.StatusBadRequest)
+		return
+	}
+
+	username := currentUser(r).Username
+
+	var params map[string]interface{}
+	if err := json.Unmarshal([]byte(r.FormValue("params")), &params); err != nil || params == nil {
+		writeJsonError(w, "Ошибка декодирования параметров", http.StatusBadRequest)
+		return
+	}
+	items := groupItems(params, "items")
+	if len(items) < 2 || len(items) > sequenceMaxItems {
+		writeJsonError(w, fmt.Sprintf("В сюжете должно быть от 2 до %d частей, передано %d", sequenceMaxItems, len(items)), http.StatusBadRequest)
+		return
+	}
+	transition := params["transition"] != false
+	// Склейку делает задача перехода, поэтому шаблон перехода нужен и сюжету без переходов —
+	// тогда его ролик просто не попадает в склейку
+	transitionID := toString(params["transition"])
+	if _, ok := params["transition"].(bool); ok || transitionID == "" {
+		if transitionID, err = defaultTransitionTemplate(); err != nil {
+			writeJsonError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if schema, err := loadTemplateSchema(transitionID); err != nil || schema.Type != "transition" {
+		writeJsonError(w, fmt.Sprintf("Шаблон %s не является переходом", transitionID), http.StatusBadRequest)
+		return
+	}
+
+	parentUID := fmt.Sprintf("seq_%d", time.Now().UnixNano())
+	// Одна папка с файлами на все части сюжета
+	inputDir, err := newInputDir(parentUID)
+	if err != nil {
+		writeJsonError(w, "Ошибка сохранения файла", http.StatusInternalServerError)
+		log.Println("Ошибка создания папки сюжета:", err)
+		return
+	}
+	submitted := false
+	defer func() {
+		if !submitted {
+			os.RemoveAll(inputDir)
+		}
+	}()
+
+	// Сначала собираем и проверяем все части, чтобы не отправить в рендер половину сюжета
+	type part struct {
+		taskType, templateID string
+		params               map[string]interface{}
+		job                  *NexrenderJob
+	}
+	var parts []part
+	var summary []interface{}
+	var warnings []interface{}
+	for i, item := range items {
+		templateID := toString(item["template"])
+		taskType := toString(item["type"])
+		childParams, _ := item["params"].(map[string]interface{})
+		if childParams == nil {
+			childParams = make(map[string]interface{})
+		}
+		schema, err := loadTemplateSchema(templateID)
+		if err != nil {
+			writeJsonError(w, fmt.Sprintf("Часть %d: %v", i+1, err), http.StatusBadRequest)
+			return
+		}
+		if taskType == "" {
+			taskType = schema.Type
+		}
+		dropServerParams(taskType, childParams)
+		childParams["input_dir"] = inputDir
+		if err := saveSchemaUploads(r, schema, childParams, inputDir, fmt.Sprintf("item%d_", i+1)); err != nil {
+			if errorStatus(err) == http.StatusBadRequest {
+				writeJsonError(w, fmt.Sprintf("Часть %d: %v", i+1, err), http.StatusBadRequest)
+				return
+			}
+			writeJsonError(w, "Ошибка сохранения файла", http.StatusInternalServerError)
+			log.Println("Ошибка сохранения файла:", err)
+			return
+		}
+		outputPath := filepath.Join(cfg.OutputDir, fmt.Sprintf("%s_%d.mp4", parentUID, i+1))
+		childParams["output_path"] = outputPath
+		childParams["sequence_index"] = i
+		job, err := buildJob(taskType, templateID, outputPath, childParams, username)
+		if err != nil {
+			writeJsonError(w, fmt.Sprintf("Часть %d: %v", i+1, err), errorStatus(err))
+			return
+		}
+		if ws, ok := childParams["warnings"].([]interface{}); ok {
+			for _, w := range ws {
+				warnings = append(warnings, fmt.Sprintf("Часть %d: %v", i+1, w))
+			}
+		}
+		parts = append(parts, part{taskType, templateID, childParams, job})
+		summary = append(summary, map[string]interface{}{"template": templateID, "type": taskType})
+	}
+
+	finalPath := filepath.Join(cfg.OutputDir, parentUID+".mp4")
+	parentParams := map[string]interface{}{
+		"items":               summary,
+		"transition":          transition,
+		"transition_template": transitionID,
+		"output_path":         finalPath,
+		"input_dir":           inputDir,
+		"progress":            0.0,
+	}
+	saveRenderHistory(username, parentUID, "sequence", "", parentParams, "rendering")
+	// Дальше папку сюжета держит его запись в истории
+	submitted = true
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		writeJsonError(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	var parentID int64
+	err = db.QueryRow("SELECT id FROM render_history WHERE uid = ?", parentUID).Scan(&parentID)
+	db.Close()
+	if err != nil {
+		writeJsonError(w, "Ошибка записи истории рендера", http.StatusInternalServerError)
+		return
+	}
+
+	var children []string
+	for i, p := range parts {
+		uid, err := createNexrenderJob(p.job)
+		if err != nil {
+			log.Printf("Сюжет %s: часть %d не отправлена: %v", parentUID, i+1, err)
+			updateRenderHistoryStatus(parentUID, "error", "")
+			// Без этой части сюжет не склеить — уже отправленные части не рендерим зря
+			cancelSequenceParts(parentUID, children)
+			writeJsonError(w, "Ошибка отправки задачи в nexrender-server: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		saveRenderHistory(username, uid, p.taskType, p.templateID, p.params, "queued")
+		if err := setRenderParent(uid, parentID); err != nil {
+			log.Println("Ошибка записи истории рендера:", err)
+		}
+		children = append(children, uid)
+	}
+
+	log.Printf("Сюжет %s отправлен: %d задач", parentUID, len(children))
+	resp := map[string]interface{}{"status": "render_started", "uid": parentUID, "children": children}
+	if len(warnings) > 0 {
+		resp["warnings"] = warnings
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// cancelSequenceParts отменяет уже отправленные части сюжета, который не удалось отправить целиком
+func cancelSequenceParts(parentUID string, uids []string) {
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		log.Printf("Сюжет %s: части не отменены: %v", parentUID, err)
+		return
+	}
+	defer db.Close()
+	for _, uid := range uids {
+		if err := cancelRender(db, uid); err != nil {
+			log.Printf("Сюжет %s: часть %s не отменена: %v", parentUID, uid, err)
+		}
+	}
+}
+
+// addSequenceJoinAction добавляет задаче перехода склейку сюжета (params.join от submitSequenceJoin):
+// после рендера @nexrender/action-encode собирает части по списку ffconcat в итоговый MP4.
+// Действие идёт до вебхука postrender, чтобы задача считалась готовой только после склейки.
+func addSequenceJoinAction(job *NexrenderJob, params map[string]interface{}) {
+	join, ok := params["join"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	// Список ссылается на ролик перехода по имени, поэтому и перезапуск рендерит в тот же файл
+	job.Template.Output = toString(join["render"])
+	job.Actions.Postrender = append(job.Actions.Postrender, NexrenderAction{
+		"module": "@nexrender/action-encode",
+		"input":  toString(join["list"]),
+		"output": toString(join["output"]),
+		// Части рендерятся одним шаблоном вывода, перекодирование не нужно
+		"params": map[string]interface{}{"-c": "copy"},
+	})
+}
+
+// submitSequenceJoin отправляет задачу перехода, которая склеит готовые части сюжета.
+// Список частей (ffconcat) кладётся рядом с ними в cfg.OutputDir: в нём только имена
+// файлов, так ffmpeg читает его без -safe 0.
+func submitSequenceJoin(p sequenceParent, parts []sequenceChild) error {
+	sort.SliceStable(parts, func(a, b int) bool {
+		ia, _ := toFloat(parts[a].params["sequence_index"])
+		ib, _ := toFloat(parts[b].params["sequence_index"])
+		return ia < ib
+	})
+	transitionPath := filepath.Join(cfg.OutputDir, p.uid+"_transition.mp4")
+	var list strings.Builder
+	list.WriteString("ffconcat version 1.0\n")
+	for i, c := range parts {
+		if i > 0 && p.params["transition"] != false {
+			fmt.Fprintf(&list, "file '%s'\n", filepath.Base(transitionPath))
+		}
+		fmt.Fprintf(&list, "file '%s'\n", filepath.Base(toString(c.params["output_path"])))
+	}
+	listPath := sequenceListPath(p)
+	if err := os.WriteFile(listPath, []byte(list.String()), 0644); err != nil {
+		return err
+	}
+
+	templateID := toString(p.params["transition_template"])
+	params := map[string]interface{}{
+		"output_path": transitionPath,
+		"join": map[string]interface{}{
+			"list":   listPath,
+			"render": transitionPath,
+			"output": toString(p.params["output_path"]),
+		},
+	}
+	job, err := buildJob("transition", templateID, transitionPath, params, p.username)
+	if err != nil {
+		return err
+	}
+	uid, err := createNexrenderJob(job)
+	if err != nil {
+		return err
+	}
+	saveRenderHistory(p.username, uid, "transition", templateID, params, "queued")
+	return setRenderParent(uid, p.id)
+}
+
+func sequenceListPath(p sequenceParent) string {
+	return strings.TrimSuffix(toString(p.params["output_path"]), ".mp4") + "_list.txt"
+}
+
+// sequenceParent — сюжет в работе, как он записан в render_history
+type sequenceParent struct {
+	id       int64
+	uid      string
+	username string
+	params   map[string]interface{}
+}
+
+// sequenceChild — часть сюжета, как она записана в render_history
+type sequenceChild struct {
+	taskType string
+	status   string
+	params   map[string]interface{}
+}
+
+var sequencesMutex sync.Mutex
+
+// updateSequences следит за сюжетами в работе: считает общий прогресс по частям,
+// при ошибке части ставит ошибку всему сюжету, а когда готовы все части — отправляет
+// склейку (submitSequenceJoin). Сюжет готов, когда готова задача склейки.
+// Вызывается из startStatusUpdater и из вебхука части сюжета; sequencesMutex не даёт
+// двум вызовам отправить склейку одного сюжета дважды.
+func updateSequences() {
+	sequencesMutex.Lock()
+	defer sequencesMutex.Unlock()
+
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		log.Println("Sequences: DB error:", err)
+		return
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT id, uid, username, params FROM render_history WHERE type = 'sequence' AND status IN ('queued', 'rendering')")
+	if err != nil {
+		return
+	}
+	var parents []sequenceParent
+	for rows.Next() {
+		var p sequenceParent
+		var paramsStr string
+		if err := rows.Scan(&p.id, &p.uid, &p.username, &paramsStr); err == nil {
+			_ = json.Unmarshal([]byte(paramsStr), &p.params)
+			parents = append(parents, p)
+		}
+	}
+	rows.Close()
+
+	for _, p := range parents {
+		if p.params == nil {
+			p.params = make(map[string]interface{})
+		}
+		// Перезапущенные и удалённые части заменены новыми записями с тем же parent_id
+		crows, err := db.Query(`SELECT type, status, params FROM render_history
+			WHERE parent_id = ? AND status NOT IN ('restarted', 'deleted')`, p.id)
+		if err != nil {
+			continue
+		}
+		var parts []sequenceChild
+		var join *sequenceChild
+		for crows.Next() {
+			var c sequenceChild
+			var paramsStr string
+			if err := crows.Scan(&c.taskType, &c.status, &paramsStr); err == nil {
+				_ = json.Unmarshal([]byte(paramsStr), &c.params)
+				switch {
+				case c.taskType != "transition":
+					parts = append(parts, c)
+				case c.params["join"] != nil:
+					join = &c
+				}
+				// Переходы старых сюжетов рендерились отдельной частью — склейка отрендерит свой
+			}
+		}
+		crows.Close()
+		if len(parts) == 0 {
+			continue
+		}
+
+		status := "rendering"
+		progress := 0.0
+		partsDone := true
+		for _, c := range parts {
+			switch c.status {
+			case "error", "canceled":
+				status = "error"
+			case "done":
+				progress += 1
+			default:
+				partsDone = false
+				if v, ok := c.params["progress"].(float64); ok {
+					progress += v
+				}
+			}
+		}
+		switch {
+		case status == "error":
+		case join == nil && partsDone:
+			if err := submitSequenceJoin(p, parts); err != nil {
+				log.Printf("Sequences: склейка %s не отправлена: %v", p.uid, err)
+				status = "error"
+			}
+		case join != nil:
+			switch join.status {
+			case "done":
+				status = "done"
+				progress += 1
+			case "error", "canceled":
+				status = "error"
+			default:
+				if v, ok := join.params["progress"].(float64); ok {
+					progress += v
+				}
+			}
+		}
+		// Склейка считается ещё одной частью
+		p.params["progress"] = progress / float64(len(parts)+1)
+
+		if status == "done" {
+			os.Remove(sequenceListPath(p))
+			log.Printf("Sequences: сюжет %s готов", p.uid)
+		}
+		paramsJSON, _ := json.Marshal(p.params)
+		_, _ = db.Exec("UPDATE render_history SET status = ?, params = ? WHERE id = ?", status, string(paramsJSON), p.id)
+		notifyRender(db, p.uid)
+		if status == "done" {
+			releaseInputDir(db, p.uid)
+		}
+	}
+}
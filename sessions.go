@@ -0,0 +1,255 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Сессии хранятся в таблице sessions, поэтому переживают перезапуск сервера.
+// Сессия живёт sessionIdle с последнего запроса (каждый запрос продлевает её),
+// но не дольше sessionMaxAge с входа. В БД лежит только хэш токена из cookie.
+
+const (
+	sessionIdle       = 24 * time.Hour
+	sessionMaxAge     = 30 * 24 * time.Hour
+	sessionTouchEvery = time.Minute // last_seen и expires_at обновляются не чаще раза в минуту
+)
+
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func sqlSeconds(d time.Duration) string {
+	return fmt.Sprintf("+%d seconds", int(d.Seconds()))
+}
+
+// createSession заводит сессию пользователю и возвращает токен для cookie
+func createSession(username string, r *http.Request) (string, error) {
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	// Заодно убираем истёкшие
+	_, _ = db.Exec("DELETE FROM sessions WHERE expires_at <= datetime('now')")
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	token := generateSessionID()
+	_, err = db.Exec(`INSERT INTO sessions (token_hash, username, expires_at, ip, user_agent)
+		VALUES (?, ?, datetime('now', ?), ?, ?)`,
+		hashSessionToken(token), username, sqlSeconds(sessionIdle), ip, r.UserAgent())
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// sessionUser возвращает пользователя по токену из cookie и продлевает сессию
+func sessionUser(token string) (string, bool) {
+	if token == "" {
+		return "", false
+	}
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		return "", false
+	}
+	defer db.Close()
+
+	hash := hashSessionToken(token)
+	var username string
+	var stale bool
+	err = db.QueryRow(`SELECT username, last_seen <= datetime('now', ?) FROM sessions
+		WHERE token_hash = ? AND expires_at > datetime('now')`,
+		fmt.Sprintf("-%d seconds", int(sessionTouchEvery.Seconds())), hash).Scan(&username, &stale)
+	if err != nil {
+		return "", false
+	}
+	if stale {
+		_, err = db.Exec(`UPDATE sessions SET last_seen = CURRENT_TIMESTAMP,
+			expires_at = MIN(datetime('now', ?), datetime(created_at, ?)) WHERE token_hash = ?`,
+			sqlSeconds(sessionIdle), sqlSeconds(sessionMaxAge), hash)
+		if err != nil {
+			log.Println("Sessions: не удалось продлить сессию:", err)
+		}
+	}
+	return username, true
+}
+
+// deleteSession — выход: сессия по токену больше не действует
+func deleteSession(token string) {
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		return
+	}
+	defer db.Close()
+	_, _ = db.Exec("DELETE FROM sessions WHERE token_hash = ?", hashSessionToken(token))
+}
+
+// revokeUserSessions завершает все сессии пользователя (блокировка, удаление)
+func revokeUserSessions(db *sql.DB, username string) (int64, error) {
+	res, err := db.Exec("DELETE FROM sessions WHERE username = ?", username)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	if n > 0 {
+		log.Printf("Sessions: завершено %d сессий пользователя %s", n, username)
+	}
+	return n, nil
+}
+
+type sessionInfo struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	CreatedAt string `json:"created_at"`
+	LastSeen  string `json:"last_seen"`
+	ExpiresAt string `json:"expires_at"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Current   bool   `json:"current"` // сессия, из которой сделан запрос
+}
+
+// listSessions — активные сессии пользователя (username == "" — всех)
+func listSessions(db *sql.DB, username, currentToken string) ([]sessionInfo, error) {
+	query := `SELECT id, username, created_at, last_seen, expires_at, COALESCE(ip, ''), COALESCE(user_agent, ''), token_hash
+		FROM sessions WHERE expires_at > datetime('now')`
+	var args []interface{}
+	if username != "" {
+		query += " AND username = ?"
+		args = append(args, username)
+	}
+	rows, err := db.Query(query+" ORDER BY last_seen DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	current := hashSessionToken(currentToken)
+	list := []sessionInfo{}
+	for rows.Next() {
+		var s sessionInfo
+		var hash string
+		if err := rows.Scan(&s.ID, &s.Username, &s.CreatedAt, &s.LastSeen, &s.ExpiresAt, &s.IP, &s.UserAgent, &hash); err != nil {
+			return nil, err
+		}
+		s.Current = hash == current
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+// Мои активные сессии
+func sessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		writeJsonError(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+	list, err := listSessions(db, user.Username, user.Session)
+	if err != nil {
+		writeJsonError(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// Завершить свою сессию (например, на чужом компьютере). POST {"id": 12}
+func revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	username := currentUser(r).Username
+	var req struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ID == 0 {
+		writeJsonError(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		writeJsonError(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+	res, err := db.Exec("DELETE FROM sessions WHERE id = ? AND username = ?", req.ID, username)
+	if err != nil {
+		writeJsonError(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeJsonError(w, "Сессия не найдена", http.StatusNotFound)
+		return
+	}
+	w.Write([]byte(`{"result":"ok"}`))
+}
+
+// Активные сессии всех пользователей (ТОЛЬКО для админа!), ?username= — одного пользователя
+func adminSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		writeJsonError(w, "DB error", 500)
+		return
+	}
+	defer db.Close()
+	list, err := listSessions(db, r.URL.Query().Get("username"), currentUser(r).Session)
+	if err != nil {
+		writeJsonError(w, "DB error", 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// Завершить сессию (ТОЛЬКО для админа!): POST {"id": 12} — одну, {"username": "..."} — все сессии пользователя
+func adminRevokeSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJsonError(w, "Method not allowed", 405)
+		return
+	}
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		writeJsonError(w, "DB error", 500)
+		return
+	}
+	defer db.Close()
+	var req struct {
+		ID       int64  `json:"id"`
+		Username string `json:"username"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.ID == 0 && req.Username == "") {
+		writeJsonError(w, "Bad request", 400)
+		return
+	}
+	var revoked int64
+	if req.ID != 0 {
+		res, err := db.Exec("DELETE FROM sessions WHERE id = ?", req.ID)
+		if err != nil {
+			writeJsonError(w, "DB error", 500)
+			return
+		}
+		revoked, _ = res.RowsAffected()
+	} else {
+		revoked, err = revokeUserSessions(db, req.Username)
+		if err != nil {
+			writeJsonError(w, "DB error", 500)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": "ok", "revoked": revoked})
+}
@@ -0,0 +1,40 @@
+package main
+
+import "strconv"
+
+// Настройки слайдшоу (options в схеме шаблона). Сколько слайдов — задаёт группа slides.
+type slideshowOptions struct {
+	MaxCaption int `json:"maxCaption"` // символов в подписи
+}
+
+// buildSlideshowParams проверяет число слайдов и наличие картинки у каждого.
+//
+// params: {"slides": [{"caption": "..."}, ...]}, картинки — файлы slide_img_%d,
+// которые saveSchemaUploads уже обрезал под пропорции шаблона (width/height поля).
+// В params добавляется slideCount — сколько слайдов показать.
+func buildSlideshowParams(schema *TemplateSchema, params map[string]interface{}) error {
+	opts := slideshowOptions{MaxCaption: 120}
+	if err := schema.decodeOptions(&opts); err != nil {
+		return err
+	}
+	g, err := schema.group("slides")
+	if err != nil {
+		return err
+	}
+	slides := groupItems(params, "slides")
+	if len(slides) < g.Min || len(slides) > g.Max {
+		return invalidf("В шаблоне должно быть от %d до %d слайдов, передано %d", g.Min, g.Max, len(slides))
+	}
+	for i, slide := range slides {
+		if toString(params["imagePath_"+strconv.Itoa(i+1)]) == "" {
+			return invalidf("Слайд %d: не загружена картинка", i+1)
+		}
+		caption, truncated := truncateText(toString(slide["caption"]), opts.MaxCaption)
+		if truncated {
+			addWarning(params, "Слайд %d: подпись обрезана до %d символов", i+1, opts.MaxCaption)
+			slide["caption"] = caption
+		}
+	}
+	params["slideCount"] = len(slides)
+	return nil
+}
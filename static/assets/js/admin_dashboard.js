@@ -37,6 +37,14 @@ async function loadUserList() {
 }
 
 // Отрисовка таблицы пользователей
+// Подсказка к статусу «Заблокирован»: причина и срок блокировки
+function blockTitle(u) {
+  let parts = [];
+  if (u.block_reason) parts.push('Причина: ' + u.block_reason);
+  parts.push(u.block_until ? 'До ' + new Date(u.block_until).toLocaleString('ru-RU') : 'Бессрочно');
+  return parts.join('. ').replace(/"/g, '&quot;');
+}
+
 function renderUserList(users) {
   const tbody = document.getElementById('userListBody');
   if (!users || !users.length) {
@@ -57,7 +65,7 @@ function renderUserList(users) {
       <td>${i+1}</td>
       <td>${u.username}</td>
       <td>${u.role}</td>
-      <td>${u.status === 'blocked' ? '<span class="badge badge-error">Заблокирован</span>' : '<span class="badge badge-success">Активен</span>'}</td>
+      <td>${u.status === 'blocked' ? `<span class="badge badge-error" title="${blockTitle(u)}">Заблокирован</span>` : '<span class="badge badge-success">Активен</span>'}</td>
       <td style="display:flex;gap:6px;">${actions.join('')}</td>
     </tr>`;
   }).join('');
@@ -81,14 +89,29 @@ function renderUserList(users) {
   tbody.querySelectorAll('.block-user-btn').forEach(btn => {
     btn.onclick = async function () {
       const username = btn.getAttribute('data-username');
-      if (!confirm(`Заблокировать пользователя ${username}?`)) return;
+      const reason = prompt(`Заблокировать пользователя ${username}?\nПричина (необязательно):`, '');
+      if (reason === null) return;
+      const days = prompt('На сколько дней? Пусто — бессрочно', '');
+      if (days === null) return;
+      const body = {username, reason};
+      if (days.trim()) {
+        const n = parseFloat(days.replace(',', '.'));
+        if (!(n > 0)) {
+          alert('Неверное число дней');
+          return;
+        }
+        body.until = new Date(Date.now() + n * 86400000).toISOString();
+      }
       const res = await fetch('/api/admin/users/block', {
         method: 'POST',
         headers: {'Content-Type': 'application/json'},
-        body: JSON.stringify({username})
+        body: JSON.stringify(body)
       });
       if (res.ok) loadUserList();
-      else alert('Ошибка блокировки пользователя');
+      else {
+        const data = await res.json().catch(() => ({}));
+        alert(data.error || 'Ошибка блокировки пользователя');
+      }
     }
   });
   tbody.querySelectorAll('.unblock-user-btn').forEach(btn => {
@@ -343,14 +366,34 @@ function timeAgo(dateString) {
   return date.toLocaleDateString("ru-RU") + " " + date.toLocaleTimeString("ru-RU").slice(0,5);
 }
 
+// --- Живые статусы рендеров (SSE): админу приходят изменения всех задач
+function applyRenderEvent(ev) {
+  if (ev.parent_uid) return; // части сюжета в списке не показываются
+  const r = lastAdminHistory.find(item => item.uid === ev.uid);
+  if (!r) {
+    loadAdminRenders(); // новая задача — перечитываем список
+    return;
+  }
+  r.status = ev.status;
+  r.progress = ev.progress;
+  if (ev.output_path) r.output_path = ev.output_path;
+  renderFilteredHistory();
+}
+
 // --- При загрузке ---
 document.addEventListener('DOMContentLoaded', () => {
   loadAdminStats();
   loadUserList();
   loadAdminRenders();
+  const liveRenders = !!window.EventSource;
+  if (liveRenders) {
+    const events = new EventSource('/api/render-events');
+    events.addEventListener('render', e => applyRenderEvent(JSON.parse(e.data)));
+    events.addEventListener('resync', loadAdminRenders);
+  }
   setInterval(() => {
     loadAdminStats();
     loadUserList();
-    loadAdminRenders();
+    if (!liveRenders) loadAdminRenders();
   }, 5000);
 });
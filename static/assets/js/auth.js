@@ -35,7 +35,12 @@ window.auth = {
         headers: {'Content-Type': 'application/json'},
         body: JSON.stringify({username, password})
       });
-      if (!resp.ok) return false;
+      if (!resp.ok) {
+        // Заблокированной учётной записи сервер отвечает 403 с причиной и сроком в тексте ошибки
+        const data = await resp.json().catch(() => ({}));
+        this.lastLoginError = data.code === 'account_blocked' ? data.error : '';
+        return false;
+      }
       this.hideLogin();
       await this.updateUserStatus();
       const renderHistoryBtn = document.getElementById('renderHistoryBtn');
@@ -174,7 +179,7 @@ window.auth = {
           this.loginError.textContent = '';
           const ok = await this.login(username, password);
           if (!ok) {
-            this.loginError.textContent = 'Неверный логин или пароль';
+            this.loginError.textContent = this.lastLoginError || 'Неверный логин или пароль';
           }
         };
       }
@@ -11,6 +11,7 @@ document.addEventListener('DOMContentLoaded', function () {
     error: "Ошибка",
     queued: "В очереди",
     rendering: "Рендер",
+    canceled: "Отменено",
     unknown: "Неизвестно"
   };
   const statusClasses = {
@@ -18,6 +19,7 @@ document.addEventListener('DOMContentLoaded', function () {
     error: "badge-error",
     queued: "badge-queued",
     rendering: "badge-rendering",
+    canceled: "badge-unknown",
     unknown: "badge-unknown"
   };
 
@@ -89,6 +91,15 @@ document.addEventListener('DOMContentLoaded', function () {
         </a>`;
       }
 
+      let cancelBtn = '';
+      if (h.status === 'queued' || h.status === 'rendering') {
+        cancelBtn = `<button type="button" class="btn cancel-render-btn" data-uid="${h.uid}" title="Отменить">
+          <svg width="18" height="18" fill="none" stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round">
+            <path d="M4 4l10 10"/><path d="M14 4L4 14"/>
+          </svg>
+        </button>`;
+      }
+
       // Tooltip для копирования
       let uidCopyBtn = `
         <div style="display:inline-block; position:relative;">
@@ -150,6 +161,7 @@ document.addEventListener('DOMContentLoaded', function () {
           <div class="time-block">${timeStr}</div>
           <div class="action-block">
           ${downloadBtn}
+            ${cancelBtn}
             ${uidCopyBtn}
           </div>
         </div>
@@ -158,6 +170,25 @@ document.addEventListener('DOMContentLoaded', function () {
 
     historyList.innerHTML = headerHTML + rowsHTML;
 
+    // --- Отмена задачи в очереди или в рендере
+    document.querySelectorAll('.cancel-render-btn').forEach(btn => {
+      btn.onclick = function (e) {
+        e.preventDefault();
+        if (!confirm('Отменить рендер?')) return;
+        fetch('/api/renders/cancel', {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ uid: btn.getAttribute('data-uid') })
+        })
+          .then(r => r.json())
+          .then(res => {
+            if (res.error) alert(res.error);
+            fetchAndUpdate();
+          })
+          .catch(err => alert('Ошибка отмены: ' + err));
+      };
+    });
+
     // --- Кнопка копирования UID с фидбеком
     document.querySelectorAll('.copy-uid-btn').forEach(btn => {
       btn.onclick = function (e) {
@@ -186,15 +217,41 @@ document.addEventListener('DOMContentLoaded', function () {
     });
   }
 
+  let lastHistory = [];
+
   function fetchAndUpdate() {
     fetch('/api/render-history')
       .then(r => r.json())
-      .then(renderHistoryList)
+      .then(history => {
+        lastHistory = history;
+        renderHistoryList(history);
+      })
       .catch(e => {
         historyList.innerHTML = `<div style="color:#c44;padding:2em;">Ошибка загрузки: ${e}</div>`;
       });
   }
 
+  // --- Живые статусы: сервер присылает изменения задач (SSE), браузер сам переподключается
+  function applyRenderEvent(ev) {
+    if (ev.parent_uid) return; // части сюжета в истории не показываются, придёт событие самого сюжета
+    const h = lastHistory.find(item => item.uid === ev.uid);
+    if (!h) {
+      fetchAndUpdate(); // новая задача — перечитываем историю
+      return;
+    }
+    h.status = ev.status;
+    h.params = h.params || {};
+    h.params.progress = ev.progress;
+    if (ev.output_path) h.params.output_path = ev.output_path;
+    renderHistoryList(lastHistory);
+  }
+
   fetchAndUpdate();
-  setInterval(fetchAndUpdate, 5000);
+  if (window.EventSource) {
+    const events = new EventSource('/api/render-events');
+    events.addEventListener('render', e => applyRenderEvent(JSON.parse(e.data)));
+    events.addEventListener('resync', fetchAndUpdate);
+  } else {
+    setInterval(fetchAndUpdate, 5000);
+  }
 });
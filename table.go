@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Настройки таблиц (options в схеме шаблона). Сколько строк — задаёт группа rows.
+type tableOptions struct {
+	MaxColumns   int  `json:"maxColumns"`
+	MaxCellChars int  `json:"maxCellChars"` // сколько символов влезает в ячейку
+	Reject       bool `json:"reject"`       // не обрезать длинный текст, а возвращать ошибку
+}
+
+// buildTableParams проверяет размеры таблицы и раскладывает ячейки по ключам cell1..N.
+//
+// params: {"columns": ["Заголовок 1", ...], "rows": [{"cells": ["...", ...]}, ...]}
+// Картинки строк приходят файлами table_img_%d (см. схему шаблона).
+// Результат: header1..N в params, cell1..N в каждой строке.
+func buildTableParams(schema *TemplateSchema, params map[string]interface{}) error {
+	opts := tableOptions{MaxColumns: 4, MaxCellChars: 40}
+	if err := schema.decodeOptions(&opts); err != nil {
+		return err
+	}
+	g, err := schema.group("rows")
+	if err != nil {
+		return err
+	}
+
+	fit := func(where, s string) (string, error) {
+		cut, truncated := truncateText(s, opts.MaxCellChars)
+		if !truncated {
+			return s, nil
+		}
+		if opts.Reject {
+			return "", invalidf("%s: текст длиннее %d символов", where, opts.MaxCellChars)
+		}
+		addWarning(params, "%s: текст обрезан до %d символов", where, opts.MaxCellChars)
+		return cut, nil
+	}
+
+	columns, _ := params["columns"].([]interface{})
+	if len(columns) == 0 {
+		return invalidf("Не переданы колонки таблицы")
+	}
+	if len(columns) > opts.MaxColumns {
+		return invalidf("В шаблоне максимум %d колонок, передано %d", opts.MaxColumns, len(columns))
+	}
+	rows := groupItems(params, "rows")
+	if len(rows) == 0 {
+		return invalidf("Не переданы строки таблицы")
+	}
+	if len(rows) > g.Max {
+		return invalidf("В шаблоне максимум %d строк, передано %d", g.Max, len(rows))
+	}
+
+	for j, c := range columns {
+		text, err := fit(fmt.Sprintf("Заголовок %d", j+1), toString(c))
+		if err != nil {
+			return err
+		}
+		params["header"+strconv.Itoa(j+1)] = text
+	}
+	// Лишние колонки шаблона очищаем, чтобы не осталось текста-заглушки
+	for j := len(columns); j < opts.MaxColumns; j++ {
+		params["header"+strconv.Itoa(j+1)] = ""
+	}
+	for i, row := range rows {
+		cells, _ := row["cells"].([]interface{})
+		if len(cells) > len(columns) {
+			return invalidf("Строка %d: ячеек больше, чем колонок (%d)", i+1, len(columns))
+		}
+		for j := 0; j < opts.MaxColumns; j++ {
+			text := ""
+			if j < len(cells) {
+				var err error
+				text, err = fit(fmt.Sprintf("Строка %d, колонка %d", i+1, j+1), toString(cells[j]))
+				if err != nil {
+					return err
+				}
+			}
+			row["cell"+strconv.Itoa(j+1)] = text
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Вафельные графики и статистика с иконками (шаблоны 8.x, 13.x)
+// Сколько категорий в шаблоне, задаёт группа categories.
+
+type waffleOptions struct {
+	Cells     int     `json:"cells"`     // сколько клеток/иконок в сетке шаблона
+	Relative  bool    `json:"relative"`  // доли — абсолютные числа, сетка заполняется целиком
+	Tolerance float64 `json:"tolerance"` // допустимое превышение суммы процентов над 100
+}
+
+// largestRemainder распределяет target целых единиц пропорционально quotas так,
+// чтобы сумма точно совпала с target (метод наибольшего остатка)
+func largestRemainder(quotas []float64, target int) []int {
+	counts := make([]int, len(quotas))
+	order := make([]int, len(quotas))
+	sum := 0
+	for i, q := range quotas {
+		counts[i] = int(math.Floor(q))
+		sum += counts[i]
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ra := quotas[order[a]] - math.Floor(quotas[order[a]])
+		rb := quotas[order[b]] - math.Floor(quotas[order[b]])
+		return ra > rb
+	})
+	for k := 0; sum < target && len(order) > 0; k++ {
+		counts[order[k%len(order)]]++
+		sum++
+	}
+	return counts
+}
+
+// buildWaffleParams переводит доли категорий в целое число клеток сетки.
+//
+// params: {"categories": [{"label": "Мужчины", "share": 48.3}, {"label": "Женщины", "share": 51.7}]}
+// В каждую категорию добавляются count (клеток), percent и percentText, в params — emptyCount.
+func buildWaffleParams(schema *TemplateSchema, params map[string]interface{}) error {
+	opts := waffleOptions{Cells: 100, Tolerance: 1}
+	if err := schema.decodeOptions(&opts); err != nil {
+		return err
+	}
+	if opts.Cells <= 0 {
+		return fmt.Errorf("Ошибка в настройках шаблона: cells должно быть больше 0")
+	}
+	g, err := schema.group("categories")
+	if err != nil {
+		return err
+	}
+
+	categories := groupItems(params, "categories")
+	if len(categories) == 0 {
+		return invalidf("Не переданы категории")
+	}
+	if len(categories) > g.Max {
+		return invalidf("В шаблоне максимум %d категорий, передано %d", g.Max, len(categories))
+	}
+
+	shares := make([]float64, len(categories))
+	sum := 0.0
+	for i, c := range categories {
+		v, ok := toFloat(c["share"])
+		if !ok || v < 0 {
+			return invalidf("Категория %d: доля должна быть неотрицательным числом", i+1)
+		}
+		shares[i] = v
+		sum += v
+	}
+	if sum == 0 {
+		return invalidf("Сумма долей равна нулю")
+	}
+
+	percents := make([]float64, len(shares))
+	for i, v := range shares {
+		if opts.Relative {
+			percents[i] = v / sum * 100
+		} else {
+			percents[i] = v
+		}
+	}
+	total := 100.0
+	if !opts.Relative {
+		if sum > 100+opts.Tolerance {
+			return invalidf("Сумма процентов %s%% больше 100%%", formatNumberRu(sum, -1))
+		}
+		total = math.Min(sum, 100)
+	}
+
+	// Сколько клеток закрашено всего, затем — раздел между категориями
+	target := int(math.Round(total / 100 * float64(opts.Cells)))
+	// Проценты чуть больше 100 (в пределах tolerance) сжимаем до целой сетки
+	scale := math.Max(100, sum)
+	if opts.Relative {
+		scale = 100
+	}
+	quotas := make([]float64, len(percents))
+	for i, p := range percents {
+		quotas[i] = p / scale * float64(opts.Cells)
+	}
+	counts := largestRemainder(quotas, target)
+
+	// В относительном режиме целые проценты тоже подгоняем, чтобы в подписях было ровно 100%
+	var labels []int
+	if opts.Relative {
+		labels = largestRemainder(percents, 100)
+	}
+
+	filled := 0
+	for i, c := range categories {
+		c["count"] = counts[i]
+		c["percent"] = percents[i]
+		if labels != nil {
+			c["percentText"] = fmt.Sprintf("%d%%", labels[i])
+		} else {
+			c["percentText"] = formatNumberRu(percents[i], -1) + "%"
+		}
+		filled += counts[i]
+	}
+	params["emptyCount"] = opts.Cells - filled
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Статусы рендера приходят от самого Nexrender: в каждую задачу добавляются
+// action-webhook на prerender (задачу взял воркер) и postrender (рендер готов).
+// Об ошибке рендера Nexrender вебхуком не сообщает — такие задачи, как и задачи,
+// чей вебхук не дошёл, подбирает редкий опрос reconcileRenders.
+
+const (
+	reconcileInterval = 30 * time.Second // как часто сверяться с Nexrender
+	reconcileAfter    = time.Minute      // сколько ждать вестей от задачи, прежде чем спросить самим
+)
+
+// webhookAction — action-webhook, который сообщит серверу uid и state задачи
+func webhookAction(event string) NexrenderAction {
+	return NexrenderAction{
+		"module":  "@nexrender/action-webhook",
+		"url":     cfg.PublicURL + "/api/nexrender/webhook?token=" + cfg.WebhookSecret,
+		"method":  "POST",
+		"headers": map[string]interface{}{"Content-Type": "application/json"},
+		"json": map[string]interface{}{
+			"uid":   "{job.uid}",
+			"state": "{job.state}",
+			"event": event,
+		},
+	}
+}
+
+// addWebhookActions добавляет в задачу вебхуки о начале и окончании рендера
+func addWebhookActions(job *NexrenderJob) {
+	job.Actions.Prerender = append(job.Actions.Prerender, webhookAction("prerender"))
+	job.Actions.Postrender = append(job.Actions.Postrender, webhookAction("postrender"))
+}
+
+// mapNexrenderState переводит state задачи Nexrender в статус render_history.
+// Незнакомый state — "": статус задачи не меняем, иначе она выпадет из опроса.
+func mapNexrenderState(state string) string {
+	switch {
+	case state == "finished":
+		return "done"
+	case state == "queued" || state == "created":
+		return "queued"
+	case state == "errored" || state == "failed" || state == "canceled":
+		return "error"
+	case state == "picked" || state == "started" || strings.HasPrefix(state, "render:"):
+		return "rendering"
+	}
+	return ""
+}
+
+// setRenderStatus записывает статус и прогресс задачи в работе (queued/rendering);
+// отменённые, удалённые и перезапущенные задачи не трогает. reported — отметить, что задача
+// сама сообщила о себе (вебхуком), тогда опрос не будет её дёргать ещё reconcileAfter.
+// Возвращает false, если такой задачи в работе нет.
+func setRenderStatus(db *sql.DB, uid, status string, progress float64, outputPath string, reported bool) (bool, error) {
+	query := "UPDATE render_history SET status = ?, params = json_set(COALESCE(params, '{}'), '$.progress', ?)"
+	args := []interface{}{status, progress}
+	if outputPath != "" {
+		query = "UPDATE render_history SET status = ?, params = json_set(COALESCE(params, '{}'), '$.progress', ?, '$.output_path', ?)"
+		args = append(args, outputPath)
+	}
+	if reported {
+		query += ", reported_at = CURRENT_TIMESTAMP"
+	}
+	query += " WHERE uid = ? AND status IN ('queued', 'rendering')"
+	args = append(args, uid)
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return false, nil
+	}
+	notifyRender(db, uid)
+	if status == "done" {
+		publishTask(db, uid)
+		releaseInputDir(db, uid)
+	}
+	return true, nil
+}
+
+// Вебхук от action-webhook Nexrender: {"uid": "...", "state": "...", "event": "prerender|postrender"}
+func nexrenderWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJsonError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if cfg.WebhookSecret == "" || r.URL.Query().Get("token") != cfg.WebhookSecret {
+		writeJsonError(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	var ev struct {
+		UID   string `json:"uid"`
+		State string `json:"state"`
+		Event string `json:"event"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&ev); err != nil || ev.UID == "" {
+		writeJsonError(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	var status string
+	var progress float64
+	switch ev.Event {
+	case "prerender":
+		status = "rendering"
+	case "postrender":
+		// output_path в params уже записан при отправке, Nexrender кладёт файл туда же
+		status, progress = "done", 1
+	default:
+		status = mapNexrenderState(ev.State)
+		if status == "done" {
+			progress = 1
+		}
+	}
+	if status == "" {
+		log.Printf("[WEBHOOK] %s | %s: незнакомый state %q, статус не меняем", ev.UID, ev.Event, ev.State)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": "ok", "updated": false})
+		return
+	}
+
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		writeJsonError(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+	updated, err := setRenderStatus(db, ev.UID, status, progress, "", true)
+	if err != nil {
+		log.Println("Webhook: ошибка записи статуса:", err)
+		writeJsonError(w, "DB error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[WEBHOOK] %s | %s (%s) -> %s", ev.UID, ev.Event, ev.State, status)
+
+	if updated {
+		var parentID sql.NullInt64
+		_ = db.QueryRow("SELECT parent_id FROM render_history WHERE uid = ?", ev.UID).Scan(&parentID)
+		if parentID.Valid {
+			go updateSequences()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": "ok", "updated": updated})
+}
+
+// startStatusUpdater запускает опрос Nexrender для задач, которые давно не сообщали о себе
+func startStatusUpdater() {
+	go func() {
+		for {
+			time.Sleep(reconcileInterval)
+			reconcileRenders()
+			updateSequences()
+		}
+	}()
+}
+
+// reconcileRenders спрашивает у Nexrender о задачах в работе, от которых не было
+// вебхука дольше reconcileAfter: упавших, потерянных сервером или с недошедшим вебхуком.
+func reconcileRenders() {
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		log.Println("StatusUpdater: DB error:", err)
+		return
+	}
+	defer db.Close()
+
+	// Сюжеты не задачи Nexrender, их статус считается по частям в updateSequences
+	rows, err := db.Query(`SELECT uid, params FROM render_history
+		WHERE status IN ('queued', 'rendering') AND COALESCE(type, '') != 'sequence'
+		AND COALESCE(reported_at, submitted_at) < datetime('now', ?)`,
+		fmt.Sprintf("-%d seconds", int(reconcileAfter.Seconds())))
+	if err != nil {
+		log.Println("StatusUpdater: DB error:", err)
+		return
+	}
+	type pending struct {
+		uid    string
+		params map[string]interface{}
+	}
+	var jobs []pending
+	for rows.Next() {
+		var p pending
+		var paramsStr string
+		if err := rows.Scan(&p.uid, &paramsStr); err == nil {
+			_ = json.Unmarshal([]byte(paramsStr), &p.params)
+			jobs = append(jobs, p)
+		}
+	}
+	rows.Close()
+
+	for _, p := range jobs {
+		var status, outputPath string
+		var progress float64
+		job, err := renderer.Status(p.uid)
+		switch {
+		case err == nil:
+			status = mapNexrenderState(job.State)
+			if status == "" {
+				log.Printf("StatusUpdater: %s: незнакомый state %q, статус не меняем", p.uid, job.State)
+				continue
+			}
+			// renderProgress у Nexrender — проценты (0..100), у старых версий бывает 0..1
+			progress = job.RenderProgress
+			if progress > 1.01 {
+				progress = progress / 100.0
+			}
+			if status == "done" {
+				progress = 1
+			}
+			outputPath = job.Output
+		case errors.Is(err, errJobNotFound):
+			// Задачи на сервере нет — смотрим, не успел ли появиться output-файл
+			opath := toString(p.params["output_path"])
+			if fi, errStat := os.Stat(opath); errStat == nil && fi.Size() > 1024*1024 {
+				status, progress = "done", 1
+				log.Printf("StatusUpdater: file найден для %s, ставим done\n", p.uid)
+			} else {
+				status = "error"
+				log.Printf("StatusUpdater: %s нет в nexrender, ставим error\n", p.uid)
+			}
+		default:
+			// Nexrender недоступен — не знаем, что с задачей, спросим в следующий раз
+			log.Printf("StatusUpdater: ошибка запроса %s: %v", p.uid, err)
+			continue
+		}
+		if _, err := setRenderStatus(db, p.uid, status, progress, outputPath, false); err != nil {
+			log.Println("StatusUpdater: ошибка записи статуса:", err)
+			continue
+		}
+		log.Printf("[PROGRESS] %s | status: %s | progress: %.2f", p.uid, status, progress)
+	}
+}